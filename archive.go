@@ -0,0 +1,414 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// maxArchiveUploadBytes bounds the raw body of /upload/archive. Unlike
+// extractTarGzBody, extractZipBody has to buffer its whole input (zip's
+// central directory sits at the end, so it can't be streamed); without a
+// cap a client could force an arbitrarily large allocation before a
+// single entry is validated, including in the server's default,
+// no-login configuration where requireRole(roleWrite, ...) is a no-op.
+var maxArchiveUploadBytes int64 = 256 << 20 // 256 MiB; var so tests can shrink it
+
+// downloadArchive streams a tar.gz or zip archive of one or more files or
+// directories under currentDir, without buffering the whole archive on
+// disk or in memory. ?path=<dir> archives a single entry; ?paths=a,b,c
+// archives several, each kept under its own top-level name.
+func downloadArchive(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    format := r.URL.Query().Get("fmt")
+    if format == "" {
+        format = "tar.gz"
+    }
+
+    var targets []string
+    if paths := r.URL.Query().Get("paths"); paths != "" {
+        for _, p := range strings.Split(paths, ",") {
+            if p = strings.TrimSpace(p); p != "" {
+                targets = append(targets, p)
+            }
+        }
+    } else if path := r.URL.Query().Get("path"); path != "" {
+        targets = []string{path}
+    } else {
+        targets = []string{"."}
+    }
+
+    archiveName := "archive"
+    if len(targets) == 1 {
+        archiveName = filepath.Base(filepath.Clean(targets[0]))
+    }
+
+    switch format {
+    case "zip":
+        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", archiveName))
+        w.Header().Set("Content-Type", "application/zip")
+        if err := streamZipArchive(w, currentDir, root, targets); err != nil {
+            log.Printf("Error streaming zip archive: %v", err)
+        }
+    case "tar.gz":
+        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar.gz", archiveName))
+        w.Header().Set("Content-Type", "application/gzip")
+        if err := streamTarGzArchive(w, currentDir, root, targets); err != nil {
+            log.Printf("Error streaming tar.gz archive: %v", err)
+        }
+    default:
+        http.Error(w, "Unsupported archive format", http.StatusBadRequest)
+    }
+}
+
+// archiveEntry is reported by walkArchiveTargets for every file/directory
+// that should go into the archive, named and symlink-resolved. path is
+// read through the active StorageBackend rather than opened directly, so
+// files that exist only as chunked-encrypted manifests (no real file on
+// disk at path) are archived correctly.
+type archiveEntry struct {
+    arcName string
+    path    string
+    entry   FileEntry
+}
+
+// statArchiveEntry resolves path to a FileEntry by listing its parent
+// directory through the active StorageBackend. Listing the parent, rather
+// than stat-ing path directly, is what lets this find files that the
+// ChunkedEncryptedBackend never materializes as a real file on disk.
+func statArchiveEntry(path, root string) (FileEntry, error) {
+    parent := filepath.Dir(path)
+    name := filepath.Base(path)
+    entries, err := backend.List(parent, root)
+    if err != nil {
+        return FileEntry{}, err
+    }
+    for _, e := range entries {
+        if e.Name == name {
+            return e, nil
+        }
+    }
+    return FileEntry{}, fmt.Errorf("not found: %s", path)
+}
+
+// walkArchiveTargets walks each requested target under currentDir,
+// resolving symlinks and re-checking isPathSafe against root so a symlink
+// can't be used to smuggle files from outside the session root into the
+// archive.
+func walkArchiveTargets(currentDir, root string, targets []string, visit func(archiveEntry) error) error {
+    visited := make(map[string]struct{})
+    for _, t := range targets {
+        startAbs := filepath.Join(currentDir, t)
+        if !isPathSafe(startAbs, root) {
+            return fmt.Errorf("path escapes root: %s", t)
+        }
+        arcPrefix := filepath.Base(filepath.Clean(t))
+
+        var entry FileEntry
+        if startAbs == filepath.Clean(currentDir) {
+            info, err := os.Stat(startAbs)
+            if err != nil {
+                return err
+            }
+            entry = FileEntry{Name: arcPrefix, IsDir: true, Mode: info.Mode(), ModTime: info.ModTime()}
+        } else {
+            e, err := statArchiveEntry(startAbs, root)
+            if err != nil {
+                return err
+            }
+            entry = e
+        }
+        if err := walkArchiveEntry(startAbs, arcPrefix, entry, root, visited, visit); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// walkArchiveEntry visits path (named arcName in the archive, described by
+// entry), recursing into directories itself rather than relying on
+// filepath.Walk, because filepath.Walk reports a symlink's own Lstat info
+// and never follows it: using that info directly would write a tar/zip
+// header for the symlink while copying the content of its target,
+// corrupting the archive. Every symlink is resolved and re-checked with
+// isPathSafe before its target is walked or read, so a symlink can't
+// smuggle files from outside root. Directory contents are enumerated with
+// backend.List rather than os.ReadDir, so files the active backend stores
+// as chunks/manifests rather than real files are still found. visited
+// records every directory's cleaned path as it's entered, so a symlink
+// that resolves back into an already-walked ancestor directory (e.g.
+// root/a/loop -> root) is rejected instead of recursing forever.
+func walkArchiveEntry(path, arcName string, entry FileEntry, root string, visited map[string]struct{}, visit func(archiveEntry) error) error {
+    if entry.Mode&os.ModeSymlink != 0 {
+        resolved, err := filepath.EvalSymlinks(path)
+        if err != nil {
+            return err
+        }
+        if !isPathSafe(resolved, root) {
+            return fmt.Errorf("entry escapes root: %s", path)
+        }
+        info, err := os.Stat(resolved)
+        if err != nil {
+            return err
+        }
+        resolvedEntry := FileEntry{Name: entry.Name, IsDir: info.IsDir(), Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime(), MimeType: entry.MimeType}
+        return walkArchiveEntry(resolved, arcName, resolvedEntry, root, visited, visit)
+    }
+
+    if entry.IsDir {
+        clean := filepath.Clean(path)
+        if _, seen := visited[clean]; seen {
+            return fmt.Errorf("symlink cycle detected at %s", path)
+        }
+        visited[clean] = struct{}{}
+
+        if err := visit(archiveEntry{arcName: arcName, path: path, entry: entry}); err != nil {
+            return err
+        }
+        children, err := backend.List(path, root)
+        if err != nil {
+            return err
+        }
+        for _, c := range children {
+            childPath := filepath.Join(path, c.Name)
+            childArc := filepath.Join(arcName, c.Name)
+            if err := walkArchiveEntry(childPath, childArc, c, root, visited, visit); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    return visit(archiveEntry{arcName: arcName, path: path, entry: entry})
+}
+
+func streamTarGzArchive(w http.ResponseWriter, currentDir, root string, targets []string) error {
+    flusher, _ := w.(http.Flusher)
+    gz := gzip.NewWriter(w)
+    tw := tar.NewWriter(gz)
+
+    err := walkArchiveTargets(currentDir, root, targets, func(e archiveEntry) error {
+        hdr := &tar.Header{
+            Name:    filepath.ToSlash(e.arcName),
+            Mode:    int64(e.entry.Mode.Perm()),
+            Size:    e.entry.Size,
+            ModTime: e.entry.ModTime,
+        }
+        if e.entry.IsDir {
+            hdr.Typeflag = tar.TypeDir
+            hdr.Name += "/"
+        } else {
+            hdr.Typeflag = tar.TypeReg
+        }
+        if err := tw.WriteHeader(hdr); err != nil {
+            return err
+        }
+        if !e.entry.IsDir {
+            rc, _, err := backend.Open(e.path, root)
+            if err != nil {
+                return err
+            }
+            defer rc.Close()
+            if _, err := io.Copy(tw, rc); err != nil {
+                return err
+            }
+        }
+        if flusher != nil {
+            flusher.Flush()
+        }
+        return nil
+    })
+    if closeErr := tw.Close(); err == nil {
+        err = closeErr
+    }
+    if closeErr := gz.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
+
+func streamZipArchive(w http.ResponseWriter, currentDir, root string, targets []string) error {
+    flusher, _ := w.(http.Flusher)
+    zw := zip.NewWriter(w)
+
+    err := walkArchiveTargets(currentDir, root, targets, func(e archiveEntry) error {
+        name := filepath.ToSlash(e.arcName)
+        if e.entry.IsDir {
+            _, err := zw.Create(name + "/")
+            if flusher != nil {
+                flusher.Flush()
+            }
+            return err
+        }
+        hdr := &zip.FileHeader{
+            Name:   name,
+            Method: zip.Deflate,
+        }
+        hdr.SetMode(e.entry.Mode)
+        hdr.Modified = e.entry.ModTime
+        dest, err := zw.CreateHeader(hdr)
+        if err != nil {
+            return err
+        }
+        rc, _, err := backend.Open(e.path, root)
+        if err != nil {
+            return err
+        }
+        defer rc.Close()
+        if _, err := io.Copy(dest, rc); err != nil {
+            return err
+        }
+        if flusher != nil {
+            flusher.Flush()
+        }
+        return nil
+    })
+    if closeErr := zw.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
+
+// uploadArchive extracts a tar.gz or zip archive, sent as the raw request
+// body, into currentDir. Every entry is re-validated with isPathSafe after
+// path cleaning, and entries carrying the setuid or setgid bit are
+// refused.
+func uploadArchive(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    format := r.URL.Query().Get("fmt")
+    if format == "" {
+        format = "tar.gz"
+    }
+
+    body := http.MaxBytesReader(w, r.Body, maxArchiveUploadBytes)
+
+    var err error
+    switch format {
+    case "zip":
+        err = extractZipBody(body, currentDir, root)
+    case "tar.gz":
+        err = extractTarGzBody(body, currentDir, root)
+    default:
+        http.Error(w, "Unsupported archive format", http.StatusBadRequest)
+        return
+    }
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            http.Error(w, "Archive too large", http.StatusRequestEntityTooLarge)
+            return
+        }
+        http.Error(w, fmt.Sprintf("Error extracting archive: %s", err), http.StatusBadRequest)
+        return
+    }
+
+    fmt.Fprintln(w, "Archive extracted successfully")
+}
+
+func extractTarGzBody(body io.Reader, currentDir, root string) error {
+    gz, err := gzip.NewReader(body)
+    if err != nil {
+        return err
+    }
+    defer gz.Close()
+
+    tr := tar.NewReader(gz)
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        if err := extractArchiveEntry(hdr.Name, hdr.FileInfo(), tr, currentDir, root); err != nil {
+            return err
+        }
+    }
+}
+
+func extractZipBody(body io.Reader, currentDir, root string) error {
+    data, err := io.ReadAll(body)
+    if err != nil {
+        return err
+    }
+    zr, err := zip.NewReader(strings.NewReader(string(data)), int64(len(data)))
+    if err != nil {
+        return err
+    }
+    for _, f := range zr.File {
+        rc, err := f.Open()
+        if err != nil {
+            return err
+        }
+        err = extractArchiveEntry(f.Name, f.FileInfo(), rc, currentDir, root)
+        rc.Close()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// backendMkdirAll creates path and any missing parents under root through
+// backend, mirroring os.MkdirAll. backend.Mkdir only creates one level at a
+// time (and, for the encrypted backend, mirrors a manifest-side directory
+// alongside it), so archive extraction has to walk down from root creating
+// each missing ancestor the same way a manual `mkdir` would.
+func backendMkdirAll(path, root string) error {
+    path = filepath.Clean(path)
+    root = filepath.Clean(root)
+    if path == root {
+        return nil
+    }
+    if info, err := os.Stat(path); err == nil {
+        if !info.IsDir() {
+            return fmt.Errorf("%s exists and is not a directory", path)
+        }
+        return nil
+    }
+    if err := backendMkdirAll(filepath.Dir(path), root); err != nil {
+        return err
+    }
+    if err := backend.Mkdir(path, root); err != nil && !os.IsExist(err) {
+        return err
+    }
+    return nil
+}
+
+func extractArchiveEntry(name string, info os.FileInfo, r io.Reader, currentDir, root string) error {
+    if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+        return fmt.Errorf("refusing entry with setuid/setgid bit: %s", name)
+    }
+
+    cleaned := filepath.Clean(name)
+    if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+        return fmt.Errorf("refusing entry with unsafe path: %s", name)
+    }
+
+    target := filepath.Join(currentDir, cleaned)
+    if !isPathSafe(target, root) {
+        return fmt.Errorf("entry escapes root: %s", name)
+    }
+
+    if info.IsDir() {
+        return backendMkdirAll(target, root)
+    }
+
+    if err := backendMkdirAll(filepath.Dir(target), root); err != nil {
+        return err
+    }
+    out, err := backend.Create(target, root)
+    if err != nil {
+        return err
+    }
+    defer out.Close()
+    _, err = io.Copy(out, r)
+    return err
+}
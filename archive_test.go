@@ -0,0 +1,139 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestWalkArchiveEntrySymlinkToFile(t *testing.T) {
+    root := t.TempDir()
+    content := []byte("hello from the real file, longer than an empty symlink stat")
+    realPath := filepath.Join(root, "real.txt")
+    if err := os.WriteFile(realPath, content, 0644); err != nil {
+        t.Fatal(err)
+    }
+    linkPath := filepath.Join(root, "link.txt")
+    if err := os.Symlink(realPath, linkPath); err != nil {
+        t.Fatal(err)
+    }
+
+    linkInfo, err := os.Lstat(linkPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    linkEntry := FileEntry{Name: "link.txt", Mode: linkInfo.Mode(), ModTime: linkInfo.ModTime()}
+
+    var got []archiveEntry
+    err = walkArchiveEntry(linkPath, "link.txt", linkEntry, root, make(map[string]struct{}), func(e archiveEntry) error {
+        got = append(got, e)
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("walkArchiveEntry: %v", err)
+    }
+    if len(got) != 1 {
+        t.Fatalf("got %d entries, want 1", len(got))
+    }
+    if got[0].entry.IsDir {
+        t.Fatal("entry reported as a directory")
+    }
+    if got[0].entry.Size != int64(len(content)) {
+        t.Errorf("entry size = %d, want %d (the resolved target's size, not the symlink's own)", got[0].entry.Size, len(content))
+    }
+    if got[0].path != realPath {
+        t.Errorf("path = %q, want %q", got[0].path, realPath)
+    }
+}
+
+func TestWalkArchiveEntrySymlinkToDir(t *testing.T) {
+    root := t.TempDir()
+    realDir := filepath.Join(root, "realdir")
+    if err := os.Mkdir(realDir, 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(realDir, "inside.txt"), []byte("x"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    linkPath := filepath.Join(root, "linkdir")
+    if err := os.Symlink(realDir, linkPath); err != nil {
+        t.Fatal(err)
+    }
+
+    linkInfo, err := os.Lstat(linkPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    linkEntry := FileEntry{Name: "linkdir", Mode: linkInfo.Mode(), ModTime: linkInfo.ModTime()}
+
+    var names []string
+    err = walkArchiveEntry(linkPath, "linkdir", linkEntry, root, make(map[string]struct{}), func(e archiveEntry) error {
+        names = append(names, e.arcName)
+        return nil
+    })
+    if err != nil {
+        t.Fatalf("walkArchiveEntry: %v", err)
+    }
+
+    want := map[string]bool{"linkdir": false, filepath.Join("linkdir", "inside.txt"): false}
+    for _, n := range names {
+        if _, ok := want[n]; !ok {
+            t.Errorf("unexpected entry %q", n)
+            continue
+        }
+        want[n] = true
+    }
+    for n, seen := range want {
+        if !seen {
+            t.Errorf("missing entry %q", n)
+        }
+    }
+}
+
+func TestWalkArchiveTargetsRejectsSymlinkCycle(t *testing.T) {
+    root := t.TempDir()
+    sub := filepath.Join(root, "a")
+    if err := os.Mkdir(sub, 0755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Symlink(root, filepath.Join(sub, "loop")); err != nil {
+        t.Fatal(err)
+    }
+
+    done := make(chan error, 1)
+    go func() {
+        done <- walkArchiveTargets(root, root, []string{"."}, func(e archiveEntry) error {
+            return nil
+        })
+    }()
+
+    select {
+    case err := <-done:
+        if err == nil {
+            t.Fatal("walkArchiveTargets followed a symlink cycle without error")
+        }
+    case <-time.After(3 * time.Second):
+        t.Fatal("walkArchiveTargets hung on a symlink cycle")
+    }
+}
+
+func TestUploadArchiveRejectsOversizedBody(t *testing.T) {
+    prev := maxArchiveUploadBytes
+    maxArchiveUploadBytes = 16
+    t.Cleanup(func() { maxArchiveUploadBytes = prev })
+
+    root := t.TempDir()
+    body := strings.NewReader(strings.Repeat("a", int(maxArchiveUploadBytes)+1))
+    req := httptest.NewRequest(http.MethodPost, "/upload/archive?fmt=zip", body)
+    w := httptest.NewRecorder()
+
+    uploadArchive(w, req, root, root)
+
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+    }
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    "golang.org/x/crypto/argon2"
+)
+
+const (
+    roleRead  = "read"
+    roleWrite = "write"
+    roleAdmin = "admin"
+)
+
+// userRecord is one entry of the -users table.
+type userRecord struct {
+    Username   string   `json:"username"`
+    Argon2Hash string   `json:"argon2id_hash"`
+    Roles      []string `json:"roles"`
+    Home       string   `json:"home"`
+}
+
+var (
+    usersMu sync.RWMutex
+    users   map[string]userRecord // nil means auth is disabled
+
+    bearerTokens = struct {
+        sync.Mutex
+        m map[string]string // token -> username
+    }{m: make(map[string]string)}
+)
+
+// loadUsers reads a JSON array of userRecord from path and resolves each
+// user's home directory to an absolute path.
+func loadUsers(path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    var list []userRecord
+    if err := json.Unmarshal(data, &list); err != nil {
+        return fmt.Errorf("parsing users file: %w", err)
+    }
+    m := make(map[string]userRecord, len(list))
+    for _, u := range list {
+        absHome, err := filepath.Abs(u.Home)
+        if err != nil {
+            return fmt.Errorf("invalid home for user %q: %w", u.Username, err)
+        }
+        u.Home = absHome
+        m[u.Username] = u
+    }
+    usersMu.Lock()
+    users = m
+    usersMu.Unlock()
+    return nil
+}
+
+func authEnabled() bool {
+    usersMu.RLock()
+    defer usersMu.RUnlock()
+    return users != nil
+}
+
+func lookupUser(username string) (userRecord, bool) {
+    usersMu.RLock()
+    defer usersMu.RUnlock()
+    u, ok := users[username]
+    return u, ok
+}
+
+// hashPassword derives an argon2id hash for password, encoded in the usual
+// PHC-like "$argon2id$v=..$m=..,t=..,p=..$salt$hash" form, suitable for the
+// argon2id_hash field of a -users entry.
+func hashPassword(password string) (string, error) {
+    salt := make([]byte, 16)
+    if _, err := rand.Read(salt); err != nil {
+        return "", err
+    }
+    const memory, time_, threads = 64 * 1024, 1, 4
+    hash := argon2.IDKey([]byte(password), salt, time_, memory, threads, 32)
+    return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+        argon2.Version, memory, time_, threads,
+        base64.RawStdEncoding.EncodeToString(salt),
+        base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// verifyPassword checks password against an encoded argon2id hash in
+// constant time.
+func verifyPassword(encoded, password string) bool {
+    parts := strings.Split(encoded, "$")
+    if len(parts) != 6 || parts[1] != "argon2id" {
+        return false
+    }
+    var memory, time_ uint32
+    var threads uint8
+    if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time_, &threads); err != nil {
+        return false
+    }
+    salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+    if err != nil {
+        return false
+    }
+    want, err := base64.RawStdEncoding.DecodeString(parts[5])
+    if err != nil {
+        return false
+    }
+    got := argon2.IDKey([]byte(password), salt, time_, memory, threads, uint32(len(want)))
+    return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// authenticatedSession resolves the caller's session when auth is enabled,
+// either from a session cookie (browser-style) or an "Authorization:
+// Bearer <token>" header (for scripted obc use).
+func authenticatedSession(r *http.Request) (Session, string, bool) {
+    if authz := r.Header.Get("Authorization"); strings.HasPrefix(authz, "Bearer ") {
+        token := strings.TrimPrefix(authz, "Bearer ")
+        bearerTokens.Lock()
+        username, ok := bearerTokens.m[token]
+        bearerTokens.Unlock()
+        if !ok {
+            return Session{}, "", false
+        }
+
+        sess, exists := sessionStore.Get(token)
+        if !exists {
+            user, ok := lookupUser(username)
+            if !ok {
+                return Session{}, "", false
+            }
+            sess = Session{CurrentDir: user.Home, Root: user.Home, User: user.Username, Roles: user.Roles}
+        }
+        return sess, token, true
+    }
+
+    cookie, err := r.Cookie("session_id")
+    if err != nil || cookie == nil {
+        return Session{}, "", false
+    }
+    sess, exists := sessionStore.Get(cookie.Value)
+    if !exists || sess.User == "" {
+        return Session{}, "", false
+    }
+    return sess, cookie.Value, true
+}
+
+func hasRole(roles []string, want string) bool {
+    for _, r := range roles {
+        if r == want || r == roleAdmin {
+            return true
+        }
+    }
+    return false
+}
+
+// requireRole wraps a withSession handler so it 403s with Forbidden unless
+// the caller's session carries role (or admin, which implies every role).
+// It is a no-op when auth is disabled, matching the server's default
+// single-user, no-login behavior.
+func requireRole(role string, fn func(http.ResponseWriter, *http.Request, string, string)) func(http.ResponseWriter, *http.Request, string, string) {
+    return func(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+        if authEnabled() {
+            sess, _, ok := authenticatedSession(r)
+            if !ok || !hasRole(sess.Roles, role) {
+                http.Error(w, "Forbidden", http.StatusForbidden)
+                return
+            }
+        }
+        fn(w, r, currentDir, root)
+    }
+}
+
+// handleAdminSessions lists active sessions for authenticated users; admin
+// role required (enforced by requireRole).
+func handleAdminSessions(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    type sessionInfo struct {
+        User       string    `json:"user"`
+        CurrentDir string    `json:"currentDir"`
+        LastAccess time.Time `json:"lastAccess"`
+    }
+
+    all := sessionStore.All()
+    list := make([]sessionInfo, 0, len(all))
+    for _, s := range all {
+        if s.User == "" {
+            continue
+        }
+        list = append(list, sessionInfo{s.User, s.CurrentDir, s.LastAccess})
+    }
+
+    json.NewEncoder(w).Encode(list)
+}
+
+// loginLimiter is a simple token bucket per remote address, used to slow
+// down password-guessing against /login.
+type loginLimiter struct {
+    mu       sync.Mutex
+    tokens   float64
+    lastFill time.Time
+}
+
+const (
+    loginBucketCapacity = 5
+    loginRefillPerSec   = 1.0 / 30 // one more attempt every 30s
+)
+
+var (
+    loginLimitersMu sync.Mutex
+    loginLimiters   = make(map[string]*loginLimiter)
+)
+
+// loginLimiterMaxIdle is how long a limiter can sit unused before
+// cleanupLoginLimiters reclaims it.
+const loginLimiterMaxIdle = 10 * time.Minute
+
+// cleanupLoginLimiters periodically drops loginLimiters entries that have
+// sat idle long enough to have refilled to a full bucket, the same way
+// cleanupSessions ages out sessionStore entries. Without this,
+// allowLoginAttempt leaks one *loginLimiter per distinct remote address
+// for the life of the process.
+func cleanupLoginLimiters() {
+    for {
+        time.Sleep(1 * time.Minute)
+        pruneLoginLimiters(time.Now())
+    }
+}
+
+// pruneLoginLimiters removes every limiter that's been idle long enough
+// (as of now) to have refilled to a full bucket. Split out from
+// cleanupLoginLimiters so the pruning decision can be tested without
+// sleeping.
+func pruneLoginLimiters(now time.Time) {
+    loginLimitersMu.Lock()
+    defer loginLimitersMu.Unlock()
+    for addr, l := range loginLimiters {
+        l.mu.Lock()
+        idleFor := now.Sub(l.lastFill)
+        full := l.tokens+idleFor.Seconds()*loginRefillPerSec >= loginBucketCapacity
+        l.mu.Unlock()
+        if idleFor > loginLimiterMaxIdle && full {
+            delete(loginLimiters, addr)
+        }
+    }
+}
+
+func allowLoginAttempt(addr string) bool {
+    loginLimitersMu.Lock()
+    l, ok := loginLimiters[addr]
+    if !ok {
+        l = &loginLimiter{tokens: loginBucketCapacity, lastFill: time.Now()}
+        loginLimiters[addr] = l
+    }
+    loginLimitersMu.Unlock()
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    elapsed := time.Since(l.lastFill).Seconds()
+    l.tokens += elapsed * loginRefillPerSec
+    if l.tokens > loginBucketCapacity {
+        l.tokens = loginBucketCapacity
+    }
+    l.lastFill = time.Now()
+    if l.tokens < 1 {
+        return false
+    }
+    l.tokens--
+    return true
+}
+
+// handleLogin authenticates a username/password pair and, on success,
+// starts a session (HttpOnly cookie) and issues a bearer token for
+// scripted clients like obc.
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+    logRequest(r)
+
+    if !authEnabled() {
+        http.Error(w, "Authentication not configured", http.StatusNotFound)
+        return
+    }
+
+    remoteAddr := r.RemoteAddr
+    if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+        remoteAddr = host
+    }
+    if !allowLoginAttempt(remoteAddr) {
+        http.Error(w, "Too many login attempts, try again later", http.StatusTooManyRequests)
+        return
+    }
+
+    var creds struct {
+        Username string `json:"username"`
+        Password string `json:"password"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    user, ok := lookupUser(creds.Username)
+    if !ok || !verifyPassword(user.Argon2Hash, creds.Password) {
+        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+        return
+    }
+
+    // Never reuse a pre-login session ID for an authenticated session: if the
+    // caller already held an anonymous (or stale) session cookie, drop it and
+    // issue a fresh ID so a session fixed before login can't carry over the
+    // elevated privileges granted here.
+    if prior, err := r.Cookie("session_id"); err == nil && prior != nil {
+        sessionStore.Delete(prior.Value)
+    }
+
+    sessionIDVal := generateSessionID()
+    sessionStore.Set(sessionIDVal, Session{
+        CurrentDir: user.Home,
+        Root:       user.Home,
+        User:       user.Username,
+        Roles:      user.Roles,
+        LastAccess: time.Now(),
+        CSRFToken:  generateSessionID(),
+    })
+
+    http.SetCookie(w, &http.Cookie{
+        Name:     "session_id",
+        Value:    sessionIDVal,
+        HttpOnly: true,
+        Path:     "/",
+        SameSite: http.SameSiteStrictMode,
+        Secure:   r.TLS != nil,
+    })
+
+    token := generateSessionID()
+    bearerTokens.Lock()
+    bearerTokens.m[token] = user.Username
+    bearerTokens.Unlock()
+
+    json.NewEncoder(w).Encode(struct {
+        Token string `json:"token"`
+    }{token})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func withAuthEnabled(t *testing.T, roles []string) string {
+    t.Helper()
+    const token = "requirerole-token"
+
+    usersMu.Lock()
+    users = map[string]userRecord{
+        "bob": {Username: "bob", Roles: roles, Home: "/data/homes/bob"},
+    }
+    usersMu.Unlock()
+    t.Cleanup(func() {
+        usersMu.Lock()
+        users = nil
+        usersMu.Unlock()
+    })
+
+    bearerTokens.Lock()
+    bearerTokens.m[token] = "bob"
+    bearerTokens.Unlock()
+    t.Cleanup(func() {
+        bearerTokens.Lock()
+        delete(bearerTokens.m, token)
+        bearerTokens.Unlock()
+    })
+
+    sessionStore.Set(token, Session{CurrentDir: "/data/homes/bob", Root: "/data/homes/bob", User: "bob", Roles: roles})
+    t.Cleanup(func() { sessionStore.Delete(token) })
+
+    return token
+}
+
+func TestRequireRoleRejectsSessionMissingRole(t *testing.T) {
+    token := withAuthEnabled(t, []string{"write"})
+
+    var called bool
+    handler := requireRole(roleRead, func(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+        called = true
+    })
+
+    req := httptest.NewRequest(http.MethodGet, "/files", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    w := httptest.NewRecorder()
+    handler(w, req, "/data/homes/bob", "/data/homes/bob")
+
+    if called {
+        t.Fatal("requireRole invoked the handler for a session without the required role")
+    }
+    if w.Code != http.StatusForbidden {
+        t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+    }
+}
+
+func TestRequireRoleAllowsSessionWithRole(t *testing.T) {
+    token := withAuthEnabled(t, []string{"read"})
+
+    var called bool
+    handler := requireRole(roleRead, func(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+        called = true
+    })
+
+    req := httptest.NewRequest(http.MethodGet, "/files", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    w := httptest.NewRecorder()
+    handler(w, req, "/data/homes/bob", "/data/homes/bob")
+
+    if !called {
+        t.Fatal("requireRole rejected a session that carries the required role")
+    }
+}
+
+func TestPruneLoginLimitersDropsOnlyIdleEntries(t *testing.T) {
+    loginLimitersMu.Lock()
+    loginLimiters = map[string]*loginLimiter{
+        "idle":   {tokens: loginBucketCapacity, lastFill: time.Now().Add(-2 * loginLimiterMaxIdle)},
+        "recent": {tokens: 0, lastFill: time.Now()},
+    }
+    loginLimitersMu.Unlock()
+    t.Cleanup(func() {
+        loginLimitersMu.Lock()
+        loginLimiters = make(map[string]*loginLimiter)
+        loginLimitersMu.Unlock()
+    })
+
+    pruneLoginLimiters(time.Now())
+
+    loginLimitersMu.Lock()
+    defer loginLimitersMu.Unlock()
+    if _, ok := loginLimiters["idle"]; ok {
+        t.Error("pruneLoginLimiters kept an address idle long enough to have refilled")
+    }
+    if _, ok := loginLimiters["recent"]; !ok {
+        t.Error("pruneLoginLimiters dropped a limiter that's still in active use")
+    }
+}
@@ -0,0 +1,778 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+	"golang.org/x/term"
+)
+
+var (
+	sessionID   string
+	bearerToken string
+)
+
+func printUsage() {
+	fmt.Println("Usage: obc <server URL>")
+	fmt.Println("\nConnects to an Onion Box server over the Tor network.")
+	fmt.Println("\nCommands available after connection:")
+	fmt.Println("  ls                 List files in the current directory")
+        fmt.Println("  cat <file>         View file content")
+	fmt.Println("  cd <dir>           Change to a different directory")
+	fmt.Println("  put <file>         Put a file on the server")
+	fmt.Println("  get <file>         Get a file from the server")
+	fmt.Println("  rm <file>          Remove a file on the server")
+	fmt.Println("  mkdir <dir>        Create a new directory")
+	fmt.Println("  gettar <dir>       Download a directory as a tar.gz archive")
+	fmt.Println("  puttar <archive>   Upload and extract a tar.gz or zip archive")
+	fmt.Println("  quit               Quit the connection")
+	fmt.Println("\nExample:")
+	fmt.Println("  obc <onion URL>:8080")
+	fmt.Println("\nNote: Ensure the Tor service is running on 127.0.0.1:9050.")
+	fmt.Println("A server started with -tor-client-auth requires the matching x25519")
+	fmt.Println("private key to be configured in this client's torrc ClientOnionAuthDir;")
+	fmt.Println("obc has no way to supply it over the SOCKS5 connection itself.")
+}
+
+func main() {
+	var serverURL string
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		default:
+			if serverURL != "" {
+				printUsage()
+				return
+			}
+			serverURL = args[i]
+		}
+	}
+	if serverURL == "" {
+		printUsage()
+		return
+	}
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "http://" + serverURL
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:9050", nil, proxy.Direct)
+	if err != nil {
+		fmt.Println("Error connecting to Tor:", err)
+		return
+	}
+	httpTransport := &http.Transport{
+		Dial: dialer.Dial,
+	}
+	client := &http.Client{
+		Transport: httpTransport,
+	}
+	bearerToken = loadToken(serverURL)
+
+	fmt.Println("Connecting to Onion Box...")
+	req, err := http.NewRequest("GET", serverURL+"/files", nil)
+	if err != nil {
+		fmt.Println("Error connecting to server:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error connecting to server:", err)
+		return
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		fmt.Println("Login required.")
+		username, password := promptCredentials()
+		if err := login(client, serverURL, username, password); err != nil {
+			fmt.Println("Login failed:", err)
+			return
+		}
+		saveToken(serverURL, bearerToken)
+
+		req, err = http.NewRequest("GET", serverURL+"/files", nil)
+		if err != nil {
+			fmt.Println("Error connecting to server:", err)
+			return
+		}
+		addSessionCookie(req)
+		resp, err = client.Do(req)
+		if err != nil {
+			fmt.Println("Error connecting to server:", err)
+			return
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+	fmt.Println("Connection successful!")
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" {
+			sessionID = cookie.Value
+			break
+		}
+	}
+	for {
+		fmt.Print("\nls, cat <file>, cd <dir>, put <file>, get <file>, rm <file>, mkdir <dir>, gettar <dir>, puttar <archive>, quit: ")
+		var command, arg string
+		fmt.Scanln(&command, &arg)
+		switch command {
+		case "ls":
+			listFiles(client, serverURL)
+		case "put":
+			if arg == "" {
+				fmt.Println("Error: missing file name")
+				continue
+			}
+			uploadFile(client, serverURL, arg)
+		case "get":
+			if arg == "" {
+				fmt.Println("Error: missing file name")
+				continue
+			}
+			downloadFile(client, serverURL, arg)
+		case "rm":
+			if arg == "" {
+				fmt.Println("Error: missing file name")
+				continue
+			}
+			deleteFile(client, serverURL, arg)
+		case "cd":
+			if arg == "" {
+				fmt.Println("Error: missing directory name")
+				continue
+			}
+			changeDirectory(client, serverURL, arg)
+		case "mkdir":
+			if arg == "" {
+				fmt.Println("Error: missing directory name")
+				continue
+			}
+			createDirectory(client, serverURL, arg)
+		case "cat":
+			if arg == "" {
+				fmt.Println("Error: missing file name")
+				continue
+			}
+			viewFile(client, serverURL, arg)
+		case "gettar":
+			if arg == "" {
+				fmt.Println("Error: missing directory name")
+				continue
+			}
+			getArchive(client, serverURL, arg)
+		case "puttar":
+			if arg == "" {
+				fmt.Println("Error: missing archive path")
+				continue
+			}
+			putArchive(client, serverURL, arg)
+		case "quit":
+			quit(client, serverURL)
+			return
+		default:
+			fmt.Println("Unknown command")
+		}
+	}
+}
+
+func viewFile(client *http.Client, serverURL, fileName string) {
+	req, err := http.NewRequest("GET", serverURL+"/cat?file="+fileName, nil)
+	if err != nil {
+		fmt.Println("Error viewing file:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error viewing file:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+	io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+}
+
+// remoteFileEntry mirrors the server's jsonFileEntry wire shape.
+type remoteFileEntry struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Mode     string    `json:"mode"`
+	MTime    time.Time `json:"mtime"`
+	IsDir    bool      `json:"isDir"`
+	MimeType string    `json:"mimeType"`
+}
+
+func listFiles(client *http.Client, serverURL string) {
+	req, err := http.NewRequest("GET", serverURL+"/files", nil)
+	if err != nil {
+		fmt.Println("Error listing files:", err)
+		return
+	}
+	req.Header.Set("Accept", "application/json")
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error listing files:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+
+	var entries []remoteFileEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		fmt.Println("Error parsing listing:", err)
+		return
+	}
+
+	for _, e := range entries {
+		kind := "f"
+		if e.IsDir {
+			kind = "d"
+		}
+		fmt.Printf("%s  %-10s  %-8s  %s\n", kind, e.MTime.Format("2006-01-02 15:04"), humanizeBytes(e.Size), e.Name)
+	}
+	fmt.Println()
+}
+
+const maxChunkRetries = 5
+
+// uploadFile performs a resumable upload: it negotiates a token and chunk
+// size via /upload/init, sends the file in chunks to /upload/chunk
+// (retrying failed chunks with exponential backoff), and finalizes with
+// /upload/commit. This survives the connection drops common over Tor.
+func uploadFile(client *http.Client, serverURL, filePath string) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Println("Error stating file:", err)
+		return
+	}
+	size := info.Size()
+
+	initBody, _ := json.Marshal(struct {
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+	}{filepath.Base(filePath), size})
+
+	req, err := http.NewRequest("POST", serverURL+"/upload/init", bytes.NewReader(initBody))
+	if err != nil {
+		fmt.Println("Error creating request:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error starting upload:", err)
+		return
+	}
+	var initResp struct {
+		Token     string `json:"token"`
+		ChunkSize int    `json:"chunkSize"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&initResp)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error starting upload:", resp.Status)
+		return
+	}
+
+	start := time.Now()
+	var sent int64
+	buf := make([]byte, initResp.ChunkSize)
+	for sent < size {
+		n, err := file.ReadAt(buf, sent)
+		if err != nil && err != io.EOF {
+			fmt.Println("\nError reading file:", err)
+			return
+		}
+		if err := putChunkWithRetry(client, serverURL, initResp.Token, sent, buf[:n]); err != nil {
+			fmt.Println("\nError uploading chunk:", err)
+			return
+		}
+		sent += int64(n)
+		printProgress(sent, size, start)
+	}
+	fmt.Println()
+
+	req, err = http.NewRequest("POST", serverURL+"/upload/commit?token="+initResp.Token, nil)
+	if err != nil {
+		fmt.Println("Error creating request:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err = client.Do(req)
+	if err != nil {
+		fmt.Println("Error committing upload:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+
+	fmt.Println("File uploaded successfully")
+	fmt.Println()
+}
+
+func putChunkWithRetry(client *http.Client, serverURL, token string, offset int64, chunk []byte) error {
+	var lastErr error
+	for attempt := 0; attempt < maxChunkRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff(attempt))
+		}
+		url := fmt.Sprintf("%s/upload/chunk?token=%s&offset=%d", serverURL, token, offset)
+		req, err := http.NewRequest("POST", url, bytes.NewReader(chunk))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addSessionCookie(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+		lastErr = fmt.Errorf("server returned %s", resp.Status)
+
+		// A dropped connection can land the bytes server-side while losing
+		// the response, so a retry of the same offset hits 409 (the chunk
+		// now overlaps what the server already has) forever. Before
+		// retrying, check /upload/status and treat an already-covered
+		// range as success instead of spending the rest of the retry
+		// budget failing the same way.
+		if resp.StatusCode == http.StatusConflict && rangeUploaded(client, serverURL, token, offset, offset+int64(len(chunk))) {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// rangeUploaded asks /upload/status whether [start, end) has already been
+// received by the server, so putChunkWithRetry can recognize a lost ACK
+// instead of treating the resulting 409 as a failed chunk.
+func rangeUploaded(client *http.Client, serverURL, token string, start, end int64) bool {
+	req, err := http.NewRequest("GET", serverURL+"/upload/status?token="+token, nil)
+	if err != nil {
+		return false
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	var status struct {
+		Completed []struct {
+			Start int64 `json:"start"`
+			End   int64 `json:"end"`
+		} `json:"completed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return false
+	}
+	for _, rg := range status.Completed {
+		if rg.Start <= start && rg.End >= end {
+			return true
+		}
+	}
+	return false
+}
+
+func backoff(attempt int) time.Duration {
+	return time.Duration(1<<uint(attempt)) * 200 * time.Millisecond
+}
+
+func printProgress(done, total int64, start time.Time) {
+	elapsed := time.Since(start).Seconds()
+	rate := float64(done) / max(elapsed, 0.001)
+	pct := float64(done) / float64(total) * 100
+	eta := time.Duration(0)
+	if rate > 0 {
+		eta = time.Duration(float64(total-done)/rate) * time.Second
+	}
+	fmt.Printf("\r%6.2f%%  %s/%s  %s/s  ETA %s   ", pct, humanizeBytes(done), humanizeBytes(total), humanizeBytes(int64(rate)), eta.Round(time.Second))
+}
+
+func max(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func humanizeBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatInt(n, 10) + " " + units[0]
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
+
+// downloadFile fetches a file via Range requests so a dropped connection
+// over Tor can be resumed instead of restarting from byte zero.
+func downloadFile(client *http.Client, serverURL, fileName string) {
+	out, err := os.Create(fileName)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		return
+	}
+	defer out.Close()
+
+	var received int64
+	start := time.Now()
+	var total int64 = -1
+
+	for {
+		req, err := http.NewRequest("GET", serverURL+"/download?file="+fileName, nil)
+		if err != nil {
+			fmt.Println("Error downloading file:", err)
+			return
+		}
+		if received > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", received))
+		}
+		addSessionCookie(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Println("\nError downloading file:", err)
+			return
+		}
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			fmt.Println("Server returned an error:", resp.Status)
+			return
+		}
+		if total < 0 {
+			total = resp.ContentLength
+			if resp.StatusCode == http.StatusPartialContent {
+				if cr := resp.Header.Get("Content-Range"); cr != "" {
+					if idx := strings.LastIndex(cr, "/"); idx != -1 {
+						if n, err := strconv.ParseInt(cr[idx+1:], 10, 64); err == nil {
+							total = n
+						}
+					}
+				}
+			}
+		}
+
+		n, copyErr := io.Copy(out, resp.Body)
+		resp.Body.Close()
+		received += n
+		if total >= 0 {
+			printProgress(received, total, start)
+		}
+
+		if copyErr == nil {
+			break
+		}
+		fmt.Println("\nConnection dropped, resuming...")
+	}
+
+	fmt.Println()
+	fmt.Println("File downloaded successfully")
+	fmt.Println()
+}
+
+func deleteFile(client *http.Client, serverURL, fileName string) {
+	req, err := http.NewRequest(http.MethodDelete, serverURL+"/delete?file="+fileName, nil)
+	if err != nil {
+		fmt.Println("Error creating request:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error deleting file:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+	io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+}
+
+func changeDirectory(client *http.Client, serverURL, dirName string) {
+	req, err := http.NewRequest("GET", serverURL+"/cd?dir="+dirName, nil)
+	if err != nil {
+		fmt.Println("Error changing directory:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error changing directory:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+	io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+}
+
+func createDirectory(client *http.Client, serverURL, dirName string) {
+	req, err := http.NewRequest("GET", serverURL+"/mkdir?dir="+dirName, nil)
+	if err != nil {
+		fmt.Println("Error creating directory:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error creating directory:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+	io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+}
+
+// getArchive downloads dirName (relative to the session's current
+// directory on the server) as a tar.gz archive and saves it in the local
+// working directory as <base name of dirName>.tar.gz.
+func getArchive(client *http.Client, serverURL, dirName string) {
+	req, err := http.NewRequest("GET", serverURL+"/download/archive?path="+dirName+"&fmt=tar.gz", nil)
+	if err != nil {
+		fmt.Println("Error downloading archive:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error downloading archive:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+
+	archiveName := filepath.Base(dirName) + ".tar.gz"
+	out, err := os.Create(archiveName)
+	if err != nil {
+		fmt.Println("Error creating archive file:", err)
+		return
+	}
+	defer out.Close()
+	io.Copy(out, resp.Body)
+	fmt.Println("Archive downloaded to", archiveName)
+	fmt.Println()
+}
+
+// putArchive uploads a local tar.gz or zip archive (inferred from its
+// extension) and has the server extract it into the current directory.
+func putArchive(client *http.Client, serverURL, archivePath string) {
+	format := "tar.gz"
+	if strings.HasSuffix(archivePath, ".zip") {
+		format = "zip"
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		fmt.Println("Error opening archive:", err)
+		return
+	}
+	defer file.Close()
+
+	req, err := http.NewRequest("POST", serverURL+"/upload/archive?fmt="+format, file)
+	if err != nil {
+		fmt.Println("Error creating request:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error uploading archive:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+	io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+}
+
+func quit(client *http.Client, serverURL string) {
+	req, err := http.NewRequest("GET", serverURL+"/quit", nil)
+	if err != nil {
+		fmt.Println("Error closing connection:", err)
+		return
+	}
+	addSessionCookie(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error closing connection:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Server returned an error:", resp.Status)
+		return
+	}
+	fmt.Println("Connection closed")
+	fmt.Println()
+}
+
+func addSessionCookie(req *http.Request) {
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+	}
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+}
+
+// promptCredentials reads a username and, with terminal echo disabled, a
+// password from stdin.
+func promptCredentials() (string, string) {
+	fmt.Print("Username: ")
+	var username string
+	fmt.Scanln(&username)
+
+	fmt.Print("Password: ")
+	passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		fmt.Println("Error reading password:", err)
+		return username, ""
+	}
+	return username, string(passwordBytes)
+}
+
+// login authenticates against /login, storing the session cookie and
+// bearer token returned by the server.
+func login(client *http.Client, serverURL, username, password string) error {
+	body, err := json.Marshal(struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{username, password})
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(serverURL+"/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" {
+			sessionID = cookie.Value
+		}
+	}
+
+	var loginResp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
+		return err
+	}
+	bearerToken = loginResp.Token
+	return nil
+}
+
+func tokensPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "obc", "tokens"), nil
+}
+
+// loadToken returns the bearer token previously persisted for serverURL,
+// or "" if none is on file.
+func loadToken(serverURL string) string {
+	path, err := tokensPath()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var tokens map[string]string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return ""
+	}
+	return tokens[serverURL]
+}
+
+// saveToken persists the bearer token for serverURL to
+// ~/.config/obc/tokens, so future connections skip the login prompt.
+func saveToken(serverURL, token string) {
+	path, err := tokensPath()
+	if err != nil {
+		return
+	}
+	tokens := map[string]string{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &tokens)
+	}
+	tokens[serverURL] = token
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0600)
+}
\ No newline at end of file
@@ -3,40 +3,62 @@ package main
 import (
     "crypto/rand"
     "encoding/hex"
+    "encoding/json"
     "fmt"
     "io"
     "log"
     "net/http"
     "os"
-    "os/exec"
     "path/filepath"
-    "runtime"
+    "sort"
     "strings"
-    "sync"
     "time"
 )
 
 type Session struct {
     CurrentDir string
+    Root       string
+    User       string
+    Roles      []string
     LastAccess time.Time
+    CSRFToken  string
 }
 
 var (
     originalRoot string
-    sessionStore = struct {
-        sync.Mutex
-        sessions map[string]Session
-    }{sessions: make(map[string]Session)}
+    backend      StorageBackend = PlainBackend{}
+    sessionStore SessionStore   = NewShardedMemoryStore()
 )
 
 func main() {
     if len(os.Args) < 3 {
-        fmt.Println("Usage: obs -f <folder> [-p <port>]")
+        fmt.Println("Usage: obs -f <folder> [-p <port>] [-k <keyfile>] [-users <file>] [-session-db <path>] [-tor [-tor-auth <auth>] [-tor-key <path>] [-tor-client-auth <pubkey>]]")
+        return
+    }
+
+    if os.Args[1] == "-hashpw" {
+        if len(os.Args) != 3 {
+            fmt.Println("Usage: obs -hashpw <password>")
+            return
+        }
+        hash, err := hashPassword(os.Args[2])
+        if err != nil {
+            fmt.Println("Error hashing password:", err)
+            return
+        }
+        fmt.Println(hash)
         return
     }
 
     var port string
     var rootFolder string
+    var keyFile string
+    var torMode bool
+    var torAuth string
+    var torKeyPath string
+    var torClientAuth string
+    var usersFile string
+    var sessionDBPath string
 
     for i := 1; i < len(os.Args); i++ {
         switch os.Args[i] {
@@ -46,6 +68,26 @@ func main() {
         case "-p":
             port = os.Args[i+1]
             i++
+        case "-k":
+            keyFile = os.Args[i+1]
+            i++
+        case "-tor":
+            torMode = true
+        case "-tor-auth":
+            torAuth = os.Args[i+1]
+            i++
+        case "-tor-key":
+            torKeyPath = os.Args[i+1]
+            i++
+        case "-tor-client-auth":
+            torClientAuth = os.Args[i+1]
+            i++
+        case "-users":
+            usersFile = os.Args[i+1]
+            i++
+        case "-session-db":
+            sessionDBPath = os.Args[i+1]
+            i++
         default:
             fmt.Printf("Unknown flag: %s\n", os.Args[i])
             return
@@ -59,24 +101,88 @@ func main() {
     }
     originalRoot = absRoot
 
-    http.HandleFunc("/files", withSession(listFiles))
-    http.HandleFunc("/upload", withSession(uploadFile))
-    http.HandleFunc("/download", withSession(downloadFile))
-    http.HandleFunc("/delete", withSession(deleteFile))
-    http.HandleFunc("/cd", withSession(changeDirectory))
-    http.HandleFunc("/mkdir", withSession(createDirectory))
+    if keyFile != "" {
+        enc, err := NewChunkedEncryptedBackend(originalRoot, keyFile)
+        if err != nil {
+            fmt.Println("Error initializing encrypted storage backend:", err)
+            return
+        }
+        backend = enc
+        fmt.Println("Storage backend: encrypted, content-addressed chunks")
+    }
+
+    if usersFile != "" {
+        if err := loadUsers(usersFile); err != nil {
+            fmt.Println("Error loading users file:", err)
+            return
+        }
+        fmt.Println("Multi-user auth enabled")
+    }
+
+    if sessionDBPath != "" {
+        store, err := NewBoltSessionStore(sessionDBPath)
+        if err != nil {
+            fmt.Println("Error opening session database:", err)
+            return
+        }
+        sessionStore = store
+        fmt.Println("Session store: persistent,", sessionDBPath)
+    }
+
+    http.HandleFunc("/login", handleLogin)
+    http.HandleFunc("/files", withSession(requireRole(roleRead, listFiles)))
+    http.HandleFunc("/cat", withSession(requireRole(roleRead, catFile)))
+    http.HandleFunc("/upload", withSession(requireRole(roleWrite, uploadFile)))
+    http.HandleFunc("/upload/init", withSession(requireRole(roleWrite, handleUploadInit)))
+    http.HandleFunc("/upload/chunk", withSession(requireRole(roleWrite, handleUploadChunk)))
+    http.HandleFunc("/upload/commit", withSession(requireRole(roleWrite, handleUploadCommit)))
+    http.HandleFunc("/upload/status", withSession(handleUploadStatus))
+    http.HandleFunc("/download", withSession(requireRole(roleRead, downloadFile)))
+    http.HandleFunc("/delete", withSession(requireRole(roleWrite, deleteFile)))
+    http.HandleFunc("/cd", withSession(requireRole(roleRead, changeDirectory)))
+    http.HandleFunc("/mkdir", withSession(requireRole(roleWrite, createDirectory)))
     http.HandleFunc("/quit", withSession(handleQuit))
+    http.HandleFunc("/admin/sessions", withSession(requireRole(roleAdmin, handleAdminSessions)))
+    http.HandleFunc("/download/archive", withSession(requireRole(roleRead, downloadArchive)))
+    http.HandleFunc("/upload/archive", withSession(requireRole(roleWrite, uploadArchive)))
 
     go cleanupSessions()
+    go cleanupLoginLimiters()
+
+    if torMode {
+        onionAddr, err := setupOnionService(port, "", torAuth, torKeyPath, torClientAuth)
+        if err != nil {
+            fmt.Println("Error provisioning onion service:", err)
+            return
+        }
+        fmt.Println("Onion service address:", onionAddr)
+        // The onion service forwards from Tor straight to our loopback
+        // listener, so there's no need to bind on all interfaces.
+        fmt.Printf("Server started on 127.0.0.1:%s with root: %s\n", port, originalRoot)
+        http.ListenAndServe("127.0.0.1:"+port, nil)
+        return
+    }
 
     fmt.Printf("Server started on port %s with root: %s\n", port, originalRoot)
     http.ListenAndServe(":"+port, nil)
 }
 
-func withSession(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+func withSession(fn func(http.ResponseWriter, *http.Request, string, string)) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         logRequest(r)
 
+        if authEnabled() {
+            session, sessionIDVal, ok := authenticatedSession(r)
+            if !ok {
+                http.Error(w, "Authentication required", http.StatusUnauthorized)
+                return
+            }
+            session.LastAccess = time.Now()
+            sessionStore.Set(sessionIDVal, session)
+            fn(w, r, session.CurrentDir, session.Root)
+            return
+        }
+
         sessionID, err := r.Cookie("session_id")
         if err != nil || sessionID == nil {
             sessionID = &http.Cookie{
@@ -84,44 +190,60 @@ func withSession(fn func(http.ResponseWriter, *http.Request, string)) http.Handl
                 Value:    generateSessionID(),
                 HttpOnly: true,
                 Path:     "/",
-                // Secure:   true,
+                SameSite: http.SameSiteStrictMode,
+                Secure:   r.TLS != nil,
             }
             http.SetCookie(w, sessionID)
-            sessionStore.Lock()
-            sessionStore.sessions[sessionID.Value] = Session{
+            sessionStore.Set(sessionID.Value, Session{
                 CurrentDir: originalRoot,
+                Root:       originalRoot,
                 LastAccess: time.Now(),
-            }
-            sessionStore.Unlock()
+                CSRFToken:  generateSessionID(),
+            })
             fmt.Printf("New session created: %s\n", sessionID.Value)
+        } else if sess, exists := sessionStore.Get(sessionID.Value); !exists {
+            newSessionID := generateSessionID()
+            sessionID.Value = newSessionID
+            http.SetCookie(w, sessionID)
+            sessionStore.Set(newSessionID, Session{
+                CurrentDir: originalRoot,
+                Root:       originalRoot,
+                LastAccess: time.Now(),
+                CSRFToken:  generateSessionID(),
+            })
+            fmt.Printf("Existing session not found, new session created: %s\n", newSessionID)
         } else {
-            sessionStore.Lock()
-            if _, exists := sessionStore.sessions[sessionID.Value]; !exists {
-                newSessionID := generateSessionID()
-                sessionID.Value = newSessionID
-                http.SetCookie(w, sessionID)
-                sessionStore.sessions[newSessionID] = Session{
-                    CurrentDir: originalRoot,
-                    LastAccess: time.Now(),
-                }
-                fmt.Printf("Existing session not found, new session created: %s\n", newSessionID)
-            } else {
-                session := sessionStore.sessions[sessionID.Value]
-                session.LastAccess = time.Now()
-                sessionStore.sessions[sessionID.Value] = session
-                fmt.Printf("Existing session found: %s\n", sessionID.Value)
-            }
-            sessionStore.Unlock()
+            sess.LastAccess = time.Now()
+            sessionStore.Set(sessionID.Value, sess)
+            fmt.Printf("Existing session found: %s\n", sessionID.Value)
         }
 
-        sessionStore.Lock()
-        currentSession := sessionStore.sessions[sessionID.Value]
-        sessionStore.Unlock()
+        currentSession, _ := sessionStore.Get(sessionID.Value)
 
-        fn(w, r, currentSession.CurrentDir)
+        fn(w, r, currentSession.CurrentDir, currentSession.Root)
     }
 }
 
+// currentSessionKey resolves the same sessionStore key withSession used to
+// dispatch this request, so handlers that need to mutate or attribute a
+// session (e.g. changeDirectory, the resumable upload endpoints) update the
+// entry the next request will actually look up instead of a stale cookie
+// value. Without -users it returns the request's own session_id cookie, so
+// on a request whose cookie withSession had to replace (missing, or not in
+// sessionStore) it returns that old value, or ok=false when there was no
+// cookie, not the newly issued ID.
+func currentSessionKey(r *http.Request) (string, bool) {
+    if authEnabled() {
+        _, sessionIDVal, ok := authenticatedSession(r)
+        return sessionIDVal, ok
+    }
+    sessionID, err := r.Cookie("session_id")
+    if err != nil || sessionID == nil {
+        return "", false
+    }
+    return sessionID.Value, true
+}
+
 func generateSessionID() string {
     bytes := make([]byte, 16)
     rand.Read(bytes)
@@ -131,13 +253,7 @@ func generateSessionID() string {
 func cleanupSessions() {
     for {
         time.Sleep(1 * time.Minute)
-        sessionStore.Lock()
-        for id, sess := range sessionStore.sessions {
-            if time.Since(sess.LastAccess) > 5*time.Minute {
-                delete(sessionStore.sessions, id)
-            }
-        }
-        sessionStore.Unlock()
+        sessionStore.DeleteOlderThan(5 * time.Minute)
     }
 }
 
@@ -145,24 +261,120 @@ func logRequest(r *http.Request) {
     fmt.Printf("[%s] %s %s\n", r.RemoteAddr, r.Method, r.URL)
 }
 
-func listFiles(w http.ResponseWriter, r *http.Request, currentDir string) {
-    var cmd *exec.Cmd
-    if runtime.GOOS == "windows" {
-        cmd = exec.Command("cmd", "/C", "dir", currentDir)
-    } else {
-        cmd = exec.Command("ls", "-la", currentDir)
+// jsonFileEntry is the wire shape of one entry in the JSON form of
+// listFiles.
+type jsonFileEntry struct {
+    Name     string    `json:"name"`
+    Size     int64     `json:"size"`
+    Mode     string    `json:"mode"`
+    MTime    time.Time `json:"mtime"`
+    IsDir    bool      `json:"isDir"`
+    MimeType string    `json:"mimeType"`
+}
+
+const maxDisplayNameLen = 22
+
+func listFiles(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    showAll := r.URL.Query().Get("all") == "1"
+
+    entries, err := backend.List(currentDir, root)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Error listing files: %s", err), http.StatusInternalServerError)
+        return
+    }
+
+    filtered := entries[:0]
+    for _, e := range entries {
+        if !showAll && strings.HasPrefix(e.Name, ".") {
+            continue
+        }
+        filtered = append(filtered, e)
+    }
+    entries = filtered
+
+    sort.Slice(entries, func(i, j int) bool {
+        if entries[i].IsDir != entries[j].IsDir {
+            return entries[i].IsDir
+        }
+        return entries[i].Name < entries[j].Name
+    })
+
+    if r.Header.Get("Accept") == "application/json" {
+        out := make([]jsonFileEntry, 0, len(entries))
+        for _, e := range entries {
+            out = append(out, jsonFileEntry{
+                Name:     e.Name,
+                Size:     e.Size,
+                Mode:     e.Mode.String(),
+                MTime:    e.ModTime,
+                IsDir:    e.IsDir,
+                MimeType: e.MimeType,
+            })
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(out)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/plain")
+    for _, e := range entries {
+        kind := "f"
+        if e.IsDir {
+            kind = "d"
+        }
+        fmt.Fprintf(w, "%s  %-8s  %s\n", kind, humanizeSize(e.Size), truncateName(e.Name))
+    }
+}
+
+func truncateName(name string) string {
+    if len(name) <= maxDisplayNameLen {
+        return name
+    }
+    return name[:maxDisplayNameLen-1] + "…"
+}
+
+func humanizeSize(size int64) string {
+    const unit = 1024
+    if size < unit {
+        return fmt.Sprintf("%dB", size)
+    }
+    div, exp := int64(unit), 0
+    for n := size / unit; n >= unit; n /= unit {
+        div *= unit
+        exp++
+    }
+    return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// catFile streams a file's contents with its sniffed mime type in
+// X-Mime-Type, for obc's "cat" command.
+func catFile(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    fileName := r.URL.Query().Get("file")
+    filePath := filepath.Join(currentDir, fileName)
+
+    if !isPathSafe(filePath, root) {
+        http.Error(w, "Invalid path", http.StatusBadRequest)
+        return
     }
 
-    output, err := cmd.CombinedOutput()
+    file, size, err := backend.Open(filePath, root)
     if err != nil {
-        http.Error(w, fmt.Sprintf("Error executing command: %s", err), http.StatusInternalServerError)
+        http.Error(w, "File not found", http.StatusNotFound)
         return
     }
+    defer file.Close()
 
-    fmt.Fprintf(w, "%s", output)
+    buf := make([]byte, 512)
+    n, _ := io.ReadFull(file, buf)
+    mimeType := http.DetectContentType(buf[:n])
+
+    w.Header().Set("X-Mime-Type", mimeType)
+    w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+    w.Write(buf[:n])
+    io.Copy(w, file)
 }
 
-func uploadFile(w http.ResponseWriter, r *http.Request, currentDir string) {
+func uploadFile(w http.ResponseWriter, r *http.Request, currentDir, root string) {
     err := r.ParseMultipartForm(10 << 20)
     if err != nil {
         http.Error(w, "Error parsing form", http.StatusBadRequest)
@@ -177,12 +389,12 @@ func uploadFile(w http.ResponseWriter, r *http.Request, currentDir string) {
     defer file.Close()
 
     filePath := filepath.Join(currentDir, handler.Filename)
-    if !isPathSafe(filePath) {
+    if !isPathSafe(filePath, root) {
         http.Error(w, "Invalid path", http.StatusBadRequest)
         return
     }
 
-    out, err := os.Create(filePath)
+    out, err := backend.Create(filePath, root)
     if err != nil {
         http.Error(w, "Error creating file", http.StatusInternalServerError)
         return
@@ -198,43 +410,51 @@ func uploadFile(w http.ResponseWriter, r *http.Request, currentDir string) {
     fmt.Fprintln(w, "File uploaded successfully")
 }
 
-func downloadFile(w http.ResponseWriter, r *http.Request, currentDir string) {
+func downloadFile(w http.ResponseWriter, r *http.Request, currentDir, root string) {
     fileName := r.URL.Query().Get("file")
     filePath := filepath.Join(currentDir, fileName)
 
-    if !isPathSafe(filePath) {
+    if !isPathSafe(filePath, root) {
         http.Error(w, "Invalid path", http.StatusBadRequest)
         return
     }
 
-    file, err := os.Open(filePath)
+    file, size, err := backend.Open(filePath, root)
     if err != nil {
         http.Error(w, "File not found", http.StatusNotFound)
         return
     }
     defer file.Close()
 
-    fileInfo, err := file.Stat()
-    if err != nil {
-        http.Error(w, "Error getting file info", http.StatusInternalServerError)
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
+    w.Header().Set("Accept-Ranges", "bytes")
+
+    if start, end, ok := parseRangeHeader(r.Header.Get("Range"), size); ok {
+        if _, err := io.CopyN(io.Discard, file, start); err != nil {
+            http.Error(w, "Error seeking file", http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+        w.Header().Set("Content-Length", fmt.Sprintf("%d", end-start+1))
+        w.WriteHeader(http.StatusPartialContent)
+        io.CopyN(w, file, end-start+1)
         return
     }
 
-    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
-    w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size())) // Setze Content-Length
+    w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
     io.Copy(w, file)
 }
 
-func deleteFile(w http.ResponseWriter, r *http.Request, currentDir string) {
+func deleteFile(w http.ResponseWriter, r *http.Request, currentDir, root string) {
     fileName := r.URL.Query().Get("file")
     filePath := filepath.Join(currentDir, fileName)
 
-    if !isPathSafe(filePath) {
+    if !isPathSafe(filePath, root) {
         http.Error(w, "Invalid path", http.StatusBadRequest)
         return
     }
 
-    err := os.Remove(filePath)
+    err := backend.Remove(filePath, root)
     if err != nil {
         log.Printf("Error deleting file: %v", err)
         http.Error(w, "Error deleting file", http.StatusInternalServerError)
@@ -244,7 +464,7 @@ func deleteFile(w http.ResponseWriter, r *http.Request, currentDir string) {
     fmt.Fprintln(w, "File deleted successfully")
 }
 
-func changeDirectory(w http.ResponseWriter, r *http.Request, currentDir string) {
+func changeDirectory(w http.ResponseWriter, r *http.Request, currentDir, root string) {
     dirName := r.URL.Query().Get("dir")
     dirName = strings.Trim(dirName, `/\ "`)
 
@@ -260,7 +480,7 @@ func changeDirectory(w http.ResponseWriter, r *http.Request, currentDir string)
     case "..":
         newDir = filepath.Dir(currentDir)
     case "root":
-        newDir = originalRoot
+        newDir = root
     default:
         newDir = filepath.Join(currentDir, dirName)
         newDir = filepath.Clean(newDir) // Normalisiert Pfad
@@ -283,7 +503,7 @@ func changeDirectory(w http.ResponseWriter, r *http.Request, currentDir string)
         return
     }
 
-    if !isPathSafe(newDir) {
+    if !isPathSafe(newDir, root) {
         http.Error(w, "Invalid path", http.StatusBadRequest)
         return
     }
@@ -295,26 +515,24 @@ func changeDirectory(w http.ResponseWriter, r *http.Request, currentDir string)
         return
     }
 
-    sessionID, err := r.Cookie("session_id")
-    if err != nil || sessionID == nil {
-        fmt.Printf("Session error: %v\n", err)
+    sessionKey, ok := currentSessionKey(r)
+    if !ok {
+        fmt.Printf("Session error: no session key for request\n")
         http.Error(w, "Session error", http.StatusInternalServerError)
         return
     }
 
-    fmt.Printf("Session ID: %s, Updating Session Directory to: %s\n", sessionID.Value, newDir)
+    fmt.Printf("Session ID: %s, Updating Session Directory to: %s\n", sessionKey, newDir)
 
-    sessionStore.Lock()
-    sessionStore.sessions[sessionID.Value] = Session{
-        CurrentDir: newDir,
-        LastAccess: time.Now(),
-    }
-    sessionStore.Unlock()
+    existing, _ := sessionStore.Get(sessionKey)
+    existing.CurrentDir = newDir
+    existing.LastAccess = time.Now()
+    sessionStore.Set(sessionKey, existing)
 
     fmt.Fprintf(w, "Directory changed to %s", newDir)
 }
 
-func createDirectory(w http.ResponseWriter, r *http.Request, currentDir string) {
+func createDirectory(w http.ResponseWriter, r *http.Request, currentDir, root string) {
     dirName := r.URL.Query().Get("dir")
     dirName = strings.Trim(dirName, `/\ "`)
     if dirName == "" {
@@ -325,12 +543,12 @@ func createDirectory(w http.ResponseWriter, r *http.Request, currentDir string)
     dirPath := filepath.Join(currentDir, dirName)
     dirPath = filepath.Clean(dirPath)
 
-    if !isPathSafe(dirPath) {
+    if !isPathSafe(dirPath, root) {
         http.Error(w, "Invalid path", http.StatusBadRequest)
         return
     }
 
-    err := os.Mkdir(dirPath, 0755)
+    err := backend.Mkdir(dirPath, root)
     if err != nil {
         http.Error(w, "Error creating directory", http.StatusInternalServerError)
         return
@@ -339,19 +557,19 @@ func createDirectory(w http.ResponseWriter, r *http.Request, currentDir string)
     fmt.Fprintln(w, "Directory created")
 }
 
-func handleQuit(w http.ResponseWriter, r *http.Request, currentDir string) {
+func handleQuit(w http.ResponseWriter, r *http.Request, currentDir, root string) {
     sessionID, err := r.Cookie("session_id")
     if err == nil && sessionID != nil {
-        sessionStore.Lock()
-        delete(sessionStore.sessions, sessionID.Value)
-        sessionStore.Unlock()
+        sessionStore.Delete(sessionID.Value)
     }
 
     fmt.Fprintln(w, "Connection closed")
 }
 
-func isPathSafe(path string) bool {
+func isPathSafe(path, root string) bool {
     absPath, _ := filepath.Abs(path)
-    absRoot, _ := filepath.Abs(originalRoot)
-    return strings.HasPrefix(strings.ToLower(absPath), strings.ToLower(absRoot))
+    absRoot, _ := filepath.Abs(root)
+    absPath = strings.ToLower(absPath)
+    absRoot = strings.ToLower(absRoot)
+    return absPath == absRoot || strings.HasPrefix(absPath, absRoot+string(filepath.Separator))
 }
\ No newline at end of file
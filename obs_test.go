@@ -0,0 +1,73 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestIsPathSafe(t *testing.T) {
+    root := "/data/homes/bob"
+    cases := []struct {
+        path string
+        want bool
+    }{
+        {"/data/homes/bob", true},
+        {"/data/homes/bob/docs", true},
+        {"/data/homes/bob/../bob", true},
+        {"/data/homes/bob2", false},
+        {"/data/homes/bob-archive", false},
+        {"/data/homes/bob/../bob2", false},
+        {"/data/homes/other", false},
+    }
+    for _, c := range cases {
+        if got := isPathSafe(c.path, root); got != c.want {
+            t.Errorf("isPathSafe(%q, %q) = %v, want %v", c.path, root, got, c.want)
+        }
+    }
+}
+
+func TestCurrentSessionKeyPrefersBearerSession(t *testing.T) {
+    usersMu.Lock()
+    users = map[string]userRecord{
+        "alice": {Username: "alice", Roles: []string{"write"}, Home: "/data/homes/alice"},
+    }
+    usersMu.Unlock()
+    defer func() {
+        usersMu.Lock()
+        users = nil
+        usersMu.Unlock()
+    }()
+
+    const token = "bearer-token-1"
+    bearerTokens.Lock()
+    bearerTokens.m[token] = "alice"
+    bearerTokens.Unlock()
+    defer func() {
+        bearerTokens.Lock()
+        delete(bearerTokens.m, token)
+        bearerTokens.Unlock()
+    }()
+
+    sessionStore.Set(token, Session{
+        CurrentDir: "/data/homes/alice",
+        Root:       "/data/homes/alice",
+        User:       "alice",
+        Roles:      []string{"write"},
+        LastAccess: time.Now(),
+    })
+    defer sessionStore.Delete(token)
+
+    req := httptest.NewRequest(http.MethodGet, "/cd?dir=docs", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.AddCookie(&http.Cookie{Name: "session_id", Value: "stale-cookie-value"})
+
+    key, ok := currentSessionKey(req)
+    if !ok {
+        t.Fatal("currentSessionKey returned ok=false")
+    }
+    if key != token {
+        t.Errorf("currentSessionKey = %q, want the bearer token %q (not the cookie value)", key, token)
+    }
+}
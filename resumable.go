@@ -0,0 +1,312 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// uploadChunkSize is the chunk size advertised to clients by /upload/init;
+// clients are free to send smaller chunks, the server only tracks byte
+// ranges.
+const uploadChunkSize = 4 << 20 // 4 MiB
+
+// byteRange is a half-open [Start, End) range of bytes received so far.
+type byteRange struct {
+    Start int64 `json:"start"`
+    End   int64 `json:"end"`
+}
+
+type uploadSession struct {
+    mu          sync.Mutex
+    owner       string // sessionStore key of the session that called /upload/init
+    filename    string
+    dir         string
+    size        int64
+    stagingPath string
+    completed   []byteRange
+}
+
+var (
+    uploadSessionsMu sync.Mutex
+    uploadSessions   = make(map[string]*uploadSession)
+)
+
+func stagingRoot() string {
+    return filepath.Join(originalRoot, ".uploads")
+}
+
+func generateUploadToken() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// handleUploadInit starts a resumable upload, returning a token and the
+// server's preferred chunk size.
+func handleUploadInit(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    var req struct {
+        Filename string `json:"filename"`
+        Size     int64  `json:"size"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+    if req.Filename == "" || req.Size < 0 {
+        http.Error(w, "Invalid filename or size", http.StatusBadRequest)
+        return
+    }
+    targetPath := filepath.Join(currentDir, req.Filename)
+    if !isPathSafe(targetPath, root) {
+        http.Error(w, "Invalid path", http.StatusBadRequest)
+        return
+    }
+
+    owner, ok := currentSessionKey(r)
+    if !ok {
+        http.Error(w, "Session error", http.StatusInternalServerError)
+        return
+    }
+
+    if err := os.MkdirAll(stagingRoot(), 0700); err != nil {
+        http.Error(w, "Error preparing staging area", http.StatusInternalServerError)
+        return
+    }
+
+    token := generateUploadToken()
+    stagingPath := filepath.Join(stagingRoot(), token)
+    f, err := os.Create(stagingPath)
+    if err != nil {
+        http.Error(w, "Error creating staging file", http.StatusInternalServerError)
+        return
+    }
+    f.Close()
+
+    uploadSessionsMu.Lock()
+    uploadSessions[token] = &uploadSession{
+        owner:       owner,
+        filename:    req.Filename,
+        dir:         currentDir,
+        size:        req.Size,
+        stagingPath: stagingPath,
+    }
+    uploadSessionsMu.Unlock()
+
+    json.NewEncoder(w).Encode(struct {
+        Token     string `json:"token"`
+        ChunkSize int    `json:"chunkSize"`
+    }{token, uploadChunkSize})
+}
+
+func getUploadSession(token string) *uploadSession {
+    uploadSessionsMu.Lock()
+    defer uploadSessionsMu.Unlock()
+    return uploadSessions[token]
+}
+
+// authorizedUploadSession looks up the upload session for token and checks
+// that r was made by the same session that created it via /upload/init, so
+// one user's in-flight upload token can't be driven by another (write-role)
+// user. Reports its own HTTP error and returns ok=false on any failure.
+func authorizedUploadSession(w http.ResponseWriter, r *http.Request, token string) (sess *uploadSession, ok bool) {
+    sess = getUploadSession(token)
+    if sess == nil {
+        http.Error(w, "Unknown upload token", http.StatusNotFound)
+        return nil, false
+    }
+    owner, keyOK := currentSessionKey(r)
+    if !keyOK || owner != sess.owner {
+        http.Error(w, "Forbidden", http.StatusForbidden)
+        return nil, false
+    }
+    return sess, true
+}
+
+// handleUploadChunk accepts a raw chunk of bytes at the given offset,
+// rejecting chunks that overlap bytes already received.
+func handleUploadChunk(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    token := r.URL.Query().Get("token")
+    offsetStr := r.URL.Query().Get("offset")
+    offset, err := strconv.ParseInt(offsetStr, 10, 64)
+    if err != nil || offset < 0 {
+        http.Error(w, "Invalid offset", http.StatusBadRequest)
+        return
+    }
+
+    sess, ok := authorizedUploadSession(w, r, token)
+    if !ok {
+        return
+    }
+
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, "Error reading chunk", http.StatusBadRequest)
+        return
+    }
+    end := offset + int64(len(body))
+
+    sess.mu.Lock()
+    defer sess.mu.Unlock()
+
+    for _, rg := range sess.completed {
+        if offset < rg.End && end > rg.Start {
+            http.Error(w, "Chunk overlaps already-received bytes", http.StatusConflict)
+            return
+        }
+    }
+
+    f, err := os.OpenFile(sess.stagingPath, os.O_WRONLY, 0600)
+    if err != nil {
+        http.Error(w, "Error opening staging file", http.StatusInternalServerError)
+        return
+    }
+    defer f.Close()
+    if _, err := f.WriteAt(body, offset); err != nil {
+        http.Error(w, "Error writing chunk", http.StatusInternalServerError)
+        return
+    }
+
+    sess.completed = mergeRange(sess.completed, byteRange{Start: offset, End: end})
+    fmt.Fprintln(w, "Chunk accepted")
+}
+
+// mergeRange inserts rg into ranges, merging with any adjacent or
+// overlapping ranges, and keeps the result sorted.
+func mergeRange(ranges []byteRange, rg byteRange) []byteRange {
+    ranges = append(ranges, rg)
+    sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+
+    merged := ranges[:1]
+    for _, r := range ranges[1:] {
+        last := &merged[len(merged)-1]
+        if r.Start <= last.End {
+            if r.End > last.End {
+                last.End = r.End
+            }
+            continue
+        }
+        merged = append(merged, r)
+    }
+    return merged
+}
+
+// handleUploadStatus reports the byte ranges received so far, so a client
+// that crashed mid-transfer can resume from where it left off.
+func handleUploadStatus(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    token := r.URL.Query().Get("token")
+    sess, ok := authorizedUploadSession(w, r, token)
+    if !ok {
+        return
+    }
+    sess.mu.Lock()
+    defer sess.mu.Unlock()
+    json.NewEncoder(w).Encode(struct {
+        Size      int64       `json:"size"`
+        Completed []byteRange `json:"completed"`
+    }{sess.size, sess.completed})
+}
+
+// handleUploadCommit finalizes a resumable upload once all bytes have
+// arrived, writing it through the active StorageBackend and discarding the
+// staging file.
+func handleUploadCommit(w http.ResponseWriter, r *http.Request, currentDir, root string) {
+    token := r.URL.Query().Get("token")
+    sess, ok := authorizedUploadSession(w, r, token)
+    if !ok {
+        return
+    }
+
+    sess.mu.Lock()
+    defer sess.mu.Unlock()
+
+    complete := len(sess.completed) == 1 && sess.completed[0].Start == 0 && sess.completed[0].End == sess.size
+    if sess.size == 0 && len(sess.completed) == 0 {
+        complete = true
+    }
+    if !complete {
+        http.Error(w, "Upload incomplete", http.StatusBadRequest)
+        return
+    }
+
+    targetPath := filepath.Join(sess.dir, sess.filename)
+    if !isPathSafe(targetPath, root) {
+        http.Error(w, "Invalid path", http.StatusBadRequest)
+        return
+    }
+
+    staged, err := os.Open(sess.stagingPath)
+    if err != nil {
+        http.Error(w, "Error reading staged upload", http.StatusInternalServerError)
+        return
+    }
+    defer staged.Close()
+
+    out, err := backend.Create(targetPath, root)
+    if err != nil {
+        http.Error(w, "Error finalizing upload", http.StatusInternalServerError)
+        return
+    }
+    defer out.Close()
+
+    if _, err := io.Copy(out, staged); err != nil {
+        http.Error(w, "Error finalizing upload", http.StatusInternalServerError)
+        return
+    }
+
+    os.Remove(sess.stagingPath)
+    uploadSessionsMu.Lock()
+    delete(uploadSessions, token)
+    uploadSessionsMu.Unlock()
+
+    fmt.Fprintln(w, "Upload committed successfully")
+}
+
+// parseRangeHeader parses a single-range "bytes=start-end" Range header
+// value against a resource of the given size. ok is false when there is no
+// usable range (absent header, multi-range, or unsatisfiable range).
+func parseRangeHeader(header string, size int64) (start, end int64, ok bool) {
+    if header == "" || !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+        return 0, 0, false
+    }
+    spec := strings.TrimPrefix(header, "bytes=")
+    parts := strings.SplitN(spec, "-", 2)
+    if len(parts) != 2 {
+        return 0, 0, false
+    }
+    if parts[0] == "" {
+        // suffix range "bytes=-N": last N bytes
+        n, err := strconv.ParseInt(parts[1], 10, 64)
+        if err != nil || n <= 0 || size == 0 {
+            return 0, 0, false
+        }
+        if n > size {
+            n = size
+        }
+        return size - n, size - 1, true
+    }
+    start, err := strconv.ParseInt(parts[0], 10, 64)
+    if err != nil || start < 0 || start >= size {
+        return 0, 0, false
+    }
+    if parts[1] == "" {
+        return start, size - 1, true
+    }
+    end, err = strconv.ParseInt(parts[1], 10, 64)
+    if err != nil || end < start {
+        return 0, 0, false
+    }
+    if end >= size {
+        end = size - 1
+    }
+    return start, end, true
+}
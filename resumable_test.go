@@ -0,0 +1,54 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestAuthorizedUploadSessionRejectsForeignSession(t *testing.T) {
+    const token = "upload-token-1"
+    uploadSessionsMu.Lock()
+    uploadSessions[token] = &uploadSession{owner: "session-a", filename: "secret.txt"}
+    uploadSessionsMu.Unlock()
+    defer func() {
+        uploadSessionsMu.Lock()
+        delete(uploadSessions, token)
+        uploadSessionsMu.Unlock()
+    }()
+
+    req := httptest.NewRequest(http.MethodPost, "/upload/chunk?token="+token, nil)
+    req.AddCookie(&http.Cookie{Name: "session_id", Value: "session-b"})
+
+    w := httptest.NewRecorder()
+    if _, ok := authorizedUploadSession(w, req, token); ok {
+        t.Fatal("authorizedUploadSession allowed a session that didn't create the token")
+    }
+    if w.Code != http.StatusForbidden {
+        t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+    }
+}
+
+func TestAuthorizedUploadSessionAllowsOwner(t *testing.T) {
+    const token = "upload-token-2"
+    uploadSessionsMu.Lock()
+    uploadSessions[token] = &uploadSession{owner: "session-a", filename: "notes.txt"}
+    uploadSessionsMu.Unlock()
+    defer func() {
+        uploadSessionsMu.Lock()
+        delete(uploadSessions, token)
+        uploadSessionsMu.Unlock()
+    }()
+
+    req := httptest.NewRequest(http.MethodPost, "/upload/chunk?token="+token, nil)
+    req.AddCookie(&http.Cookie{Name: "session_id", Value: "session-a"})
+
+    w := httptest.NewRecorder()
+    sess, ok := authorizedUploadSession(w, req, token)
+    if !ok {
+        t.Fatal("authorizedUploadSession rejected the token's own owner session")
+    }
+    if sess.filename != "notes.txt" {
+        t.Errorf("filename = %q, want %q", sess.filename, "notes.txt")
+    }
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+    "encoding/json"
+    "hash/fnv"
+    "sync"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+// SessionStore abstracts where sessions live, so the in-memory default can
+// be swapped for a persistent one without touching the handlers.
+type SessionStore interface {
+    Get(id string) (Session, bool)
+    Set(id string, s Session)
+    Delete(id string)
+    All() map[string]Session
+    DeleteOlderThan(maxAge time.Duration)
+}
+
+const sessionShardCount = 16
+
+// ShardedMemoryStore splits sessions across sessionShardCount independent
+// maps, each guarded by its own RWMutex, so concurrent requests for
+// different sessions don't serialize behind one lock the way the original
+// single-mutex map did.
+type ShardedMemoryStore struct {
+    shards [sessionShardCount]*sessionShard
+}
+
+type sessionShard struct {
+    mu       sync.RWMutex
+    sessions map[string]Session
+}
+
+func NewShardedMemoryStore() *ShardedMemoryStore {
+    s := &ShardedMemoryStore{}
+    for i := range s.shards {
+        s.shards[i] = &sessionShard{sessions: make(map[string]Session)}
+    }
+    return s
+}
+
+func (s *ShardedMemoryStore) shardFor(id string) *sessionShard {
+    h := fnv.New32()
+    h.Write([]byte(id))
+    return s.shards[h.Sum32()%sessionShardCount]
+}
+
+func (s *ShardedMemoryStore) Get(id string) (Session, bool) {
+    shard := s.shardFor(id)
+    shard.mu.RLock()
+    defer shard.mu.RUnlock()
+    sess, ok := shard.sessions[id]
+    return sess, ok
+}
+
+func (s *ShardedMemoryStore) Set(id string, sess Session) {
+    shard := s.shardFor(id)
+    shard.mu.Lock()
+    defer shard.mu.Unlock()
+    shard.sessions[id] = sess
+}
+
+func (s *ShardedMemoryStore) Delete(id string) {
+    shard := s.shardFor(id)
+    shard.mu.Lock()
+    defer shard.mu.Unlock()
+    delete(shard.sessions, id)
+}
+
+func (s *ShardedMemoryStore) All() map[string]Session {
+    out := make(map[string]Session)
+    for _, shard := range s.shards {
+        shard.mu.RLock()
+        for id, sess := range shard.sessions {
+            out[id] = sess
+        }
+        shard.mu.RUnlock()
+    }
+    return out
+}
+
+func (s *ShardedMemoryStore) DeleteOlderThan(maxAge time.Duration) {
+    cutoff := time.Now().Add(-maxAge)
+    for _, shard := range s.shards {
+        shard.mu.Lock()
+        for id, sess := range shard.sessions {
+            if sess.LastAccess.Before(cutoff) {
+                delete(shard.sessions, id)
+            }
+        }
+        shard.mu.Unlock()
+    }
+}
+
+var sessionsBucket = []byte("sessions")
+
+// BoltSessionStore persists sessions to a BoltDB file, so they survive a
+// server restart instead of vanishing with the process.
+type BoltSessionStore struct {
+    db *bolt.DB
+}
+
+func NewBoltSessionStore(path string) (*BoltSessionStore, error) {
+    db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+    if err != nil {
+        return nil, err
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        _, err := tx.CreateBucketIfNotExists(sessionsBucket)
+        return err
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &BoltSessionStore{db: db}, nil
+}
+
+func (b *BoltSessionStore) Get(id string) (Session, bool) {
+    var sess Session
+    found := false
+    b.db.View(func(tx *bolt.Tx) error {
+        data := tx.Bucket(sessionsBucket).Get([]byte(id))
+        if data == nil {
+            return nil
+        }
+        if err := json.Unmarshal(data, &sess); err == nil {
+            found = true
+        }
+        return nil
+    })
+    return sess, found
+}
+
+func (b *BoltSessionStore) Set(id string, sess Session) {
+    data, err := json.Marshal(sess)
+    if err != nil {
+        return
+    }
+    b.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(sessionsBucket).Put([]byte(id), data)
+    })
+}
+
+func (b *BoltSessionStore) Delete(id string) {
+    b.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(sessionsBucket).Delete([]byte(id))
+    })
+}
+
+func (b *BoltSessionStore) All() map[string]Session {
+    out := make(map[string]Session)
+    b.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+            var sess Session
+            if err := json.Unmarshal(v, &sess); err == nil {
+                out[string(k)] = sess
+            }
+            return nil
+        })
+    })
+    return out
+}
+
+func (b *BoltSessionStore) DeleteOlderThan(maxAge time.Duration) {
+    cutoff := time.Now().Add(-maxAge)
+    var stale [][]byte
+    b.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+            var sess Session
+            if err := json.Unmarshal(v, &sess); err == nil && sess.LastAccess.Before(cutoff) {
+                stale = append(stale, append([]byte(nil), k...))
+            }
+            return nil
+        })
+    })
+    if len(stale) == 0 {
+        return
+    }
+    b.db.Update(func(tx *bolt.Tx) error {
+        bucket := tx.Bucket(sessionsBucket)
+        for _, k := range stale {
+            if err := bucket.Delete(k); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
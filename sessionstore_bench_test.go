@@ -0,0 +1,100 @@
+package main
+
+import (
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+)
+
+// singleMutexStore is the session map's original shape (one map, one
+// mutex), kept here only as a baseline for BenchmarkSingleMutexStore.
+type singleMutexStore struct {
+    mu       sync.Mutex
+    sessions map[string]Session
+}
+
+func newSingleMutexStore() *singleMutexStore {
+    return &singleMutexStore{sessions: make(map[string]Session)}
+}
+
+func (s *singleMutexStore) Get(id string) (Session, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    sess, ok := s.sessions[id]
+    return sess, ok
+}
+
+func (s *singleMutexStore) Set(id string, sess Session) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.sessions[id] = sess
+}
+
+func (s *singleMutexStore) Delete(id string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.sessions, id)
+}
+
+func (s *singleMutexStore) All() map[string]Session {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := make(map[string]Session, len(s.sessions))
+    for k, v := range s.sessions {
+        out[k] = v
+    }
+    return out
+}
+
+func (s *singleMutexStore) DeleteOlderThan(maxAge time.Duration) {
+    cutoff := time.Now().Add(-maxAge)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for id, sess := range s.sessions {
+        if sess.LastAccess.Before(cutoff) {
+            delete(s.sessions, id)
+        }
+    }
+}
+
+func benchmarkSessionStore(b *testing.B, store SessionStore, concurrency int) {
+    ids := make([]string, 1024)
+    for i := range ids {
+        ids[i] = fmt.Sprintf("session-%d", i)
+        store.Set(ids[i], Session{LastAccess: time.Now()})
+    }
+
+    b.ResetTimer()
+    var wg sync.WaitGroup
+    perWorker := b.N / concurrency
+    if perWorker == 0 {
+        perWorker = 1
+    }
+    for w := 0; w < concurrency; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            for i := 0; i < perWorker; i++ {
+                id := ids[(w+i)%len(ids)]
+                if i%4 == 0 {
+                    store.Set(id, Session{LastAccess: time.Now()})
+                } else {
+                    store.Get(id)
+                }
+            }
+        }(w)
+    }
+    wg.Wait()
+}
+
+// BenchmarkShardedMemoryStore and BenchmarkSingleMutexStore compare the
+// sharded store against the single-mutex map it replaced, under 1k
+// simulated concurrent handlers.
+func BenchmarkShardedMemoryStore(b *testing.B) {
+    benchmarkSessionStore(b, NewShardedMemoryStore(), 1000)
+}
+
+func BenchmarkSingleMutexStore(b *testing.B) {
+    benchmarkSessionStore(b, newSingleMutexStore(), 1000)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// chunkSize is the size of each fixed-size window the chunker splits an
+// upload into before encryption.
+const chunkSize = 4 << 20 // 4 MiB
+
+// FileEntry describes one file or directory as returned by a
+// StorageBackend's List method.
+type FileEntry struct {
+	Name     string
+	Size     int64
+	Mode     os.FileMode
+	ModTime  time.Time
+	IsDir    bool
+	MimeType string
+}
+
+// StorageBackend abstracts how uploaded bytes are persisted, so the file
+// handlers don't need to know whether files live as plain files on disk or
+// as encrypted, content-addressed chunks. Every path passed in is an
+// already-validated absolute path (see isPathSafe); root is the caller's
+// session root (originalRoot for the single-user default, or a per-user
+// home under -users), which the encrypted backend needs to mirror each
+// user's files under a distinct namespace.
+type StorageBackend interface {
+	Create(path, root string) (io.WriteCloser, error)
+	Open(path, root string) (io.ReadCloser, int64, error)
+	Remove(path, root string) error
+	List(path, root string) ([]FileEntry, error)
+	Mkdir(path, root string) error
+}
+
+// PlainBackend stores files exactly where the session's current directory
+// puts them, i.e. the original, pre-encryption behavior. root is unused:
+// plain files need no namespacing, since they already live under it.
+type PlainBackend struct{}
+
+func (PlainBackend) Create(path, root string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+func (PlainBackend) Open(path, root string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (PlainBackend) Remove(path, root string) error {
+	return os.Remove(path)
+}
+
+func (PlainBackend) Mkdir(path, root string) error {
+	return os.Mkdir(path, 0755)
+}
+
+func (PlainBackend) List(path, root string) ([]FileEntry, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]FileEntry, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		mimeType := ""
+		if !e.IsDir() {
+			mimeType = sniffMimeType(filepath.Join(path, e.Name()))
+		}
+		out = append(out, FileEntry{
+			Name:     e.Name(),
+			Size:     info.Size(),
+			Mode:     info.Mode(),
+			ModTime:  info.ModTime(),
+			IsDir:    e.IsDir(),
+			MimeType: mimeType,
+		})
+	}
+	return out, nil
+}
+
+func sniffMimeType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := f.Read(buf)
+	return http.DetectContentType(buf[:n])
+}
+
+// manifest is the per-file record kept under manifests/, describing how to
+// reassemble and decrypt a file's chunks in order.
+type manifest struct {
+	Filename string        `json:"filename"`
+	Size     int64         `json:"size"`
+	MimeType string        `json:"mimetype"`
+	Chunks   []chunkRecord `json:"chunks"`
+}
+
+type chunkRecord struct {
+	Hash  string `json:"hash"`  // hex BLAKE2b-256 hash of the plaintext chunk
+	Nonce string `json:"nonce"` // hex AEAD nonce used to encrypt this chunk
+}
+
+// chunkNonce derives the AEAD nonce for a chunk from its plaintext hash
+// instead of drawing fresh randomness. Chunks are deduplicated by hash: if
+// two writers produce the same plaintext chunk but each picked its own
+// random nonce, whichever one lost the os.Stat race in flushChunk would
+// record a nonce that doesn't match the ciphertext actually sitting on
+// disk, making that chunk permanently undecryptable. Deriving the nonce
+// from the hash makes every writer of the same chunk converge on the same
+// ciphertext, so the dedup check is always safe.
+func chunkNonce(hash [blake2b.Size256]byte) []byte {
+	sum := blake2b.Sum512(append([]byte("chunk-nonce:"), hash[:]...))
+	return sum[:chacha20poly1305.NonceSizeX]
+}
+
+// ChunkedEncryptedBackend splits uploads into fixed-size chunks, encrypts
+// each with XChaCha20-Poly1305 under a shared master key, and writes them
+// to chunksDir named by the plaintext chunk's BLAKE2b hash. A JSON manifest
+// under manifestsDir (mirroring the logical directory layout) records the
+// ordered chunk list needed to reassemble the file. Because chunks are
+// named by content hash, identical chunks across files or sessions are
+// written once.
+type ChunkedEncryptedBackend struct {
+	masterKey    [32]byte
+	chunksDir    string
+	manifestsDir string
+}
+
+// NewChunkedEncryptedBackend loads the master key from keyPath (32 raw
+// bytes) and prepares the chunks/ and manifests/ directories under root.
+func NewChunkedEncryptedBackend(root, keyPath string) (*ChunkedEncryptedBackend, error) {
+	keyBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	if len(keyBytes) != 32 {
+		return nil, fmt.Errorf("key file must contain exactly 32 bytes, got %d", len(keyBytes))
+	}
+	b := &ChunkedEncryptedBackend{
+		chunksDir:    filepath.Join(root, "chunks"),
+		manifestsDir: filepath.Join(root, "manifests"),
+	}
+	copy(b.masterKey[:], keyBytes)
+	if err := os.MkdirAll(b.chunksDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(b.manifestsDir, 0700); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// rootNamespace returns a stable, filesystem-safe directory name for root,
+// so the encrypted backend can mirror several unrelated session roots (one
+// per -users home, say) under the same manifestsDir without their rel
+// paths colliding. Derived from a hash rather than root itself because
+// root is an arbitrary absolute path that may contain separators or
+// exceed filename length limits.
+func rootNamespace(root string) string {
+	sum := blake2b.Sum256([]byte(root))
+	return hex.EncodeToString(sum[:8])
+}
+
+// relUnderRoot returns path relative to root, refusing anything that would
+// resolve outside of it. Without this check, a path outside root would
+// make filepath.Rel produce a "../"-escaping path that lands outside the
+// backend's own sandboxed directories once joined under manifestsDir.
+func relUnderRoot(path, root string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path escapes storage root: %s", path)
+	}
+	return rel, nil
+}
+
+func (b *ChunkedEncryptedBackend) manifestPath(path, root string) (string, error) {
+	rel, err := relUnderRoot(path, root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(b.manifestsDir, rootNamespace(root), rel+".json"), nil
+}
+
+// Mkdir creates path itself, so changeDirectory's os.Stat still finds a
+// real directory to cd into, plus its manifest-side mirror so the new,
+// still-empty directory shows up in List before any file is ever uploaded
+// into it.
+func (b *ChunkedEncryptedBackend) Mkdir(path, root string) error {
+	rel, err := relUnderRoot(path, root)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(b.manifestsDir, rootNamespace(root), rel), 0700)
+}
+
+func (b *ChunkedEncryptedBackend) Create(path, root string) (io.WriteCloser, error) {
+	aead, err := chacha20poly1305.NewX(b.masterKey[:])
+	if err != nil {
+		return nil, err
+	}
+	mPath, err := b.manifestPath(path, root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(mPath), 0700); err != nil {
+		return nil, err
+	}
+	return &chunkWriter{
+		backend:  b,
+		aead:     aead,
+		mPath:    mPath,
+		filename: filepath.Base(path),
+		buf:      make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// chunkWriter buffers plaintext up to chunkSize, then hashes, encrypts and
+// writes each full chunk to disk before accumulating its record in the
+// manifest that gets flushed on Close.
+type chunkWriter struct {
+	backend  *ChunkedEncryptedBackend
+	aead     cipher.AEAD
+	mPath    string
+	filename string
+	buf      []byte
+	m        manifest
+	mimeSet  bool
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		n := chunkSize - len(cw.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		cw.buf = append(cw.buf, p[:n]...)
+		p = p[n:]
+		if len(cw.buf) == chunkSize {
+			if err := cw.flushChunk(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return total, nil
+}
+
+func (cw *chunkWriter) flushChunk() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	if !cw.mimeSet {
+		limit := len(cw.buf)
+		if limit > 512 {
+			limit = 512
+		}
+		cw.m.MimeType = http.DetectContentType(cw.buf[:limit])
+		cw.mimeSet = true
+	}
+	sum := blake2b.Sum256(cw.buf)
+	hash := hex.EncodeToString(sum[:])
+	nonce := chunkNonce(sum)
+	ciphertext := cw.aead.Seal(nil, nonce, cw.buf, nil)
+
+	chunkPath := filepath.Join(cw.backend.chunksDir, hash)
+	if _, err := os.Stat(chunkPath); os.IsNotExist(err) {
+		if err := os.WriteFile(chunkPath, ciphertext, 0600); err != nil {
+			return err
+		}
+	}
+
+	cw.m.Size += int64(len(cw.buf))
+	cw.m.Chunks = append(cw.m.Chunks, chunkRecord{
+		Hash:  hash,
+		Nonce: hex.EncodeToString(nonce),
+	})
+	cw.buf = cw.buf[:0]
+	return nil
+}
+
+func (cw *chunkWriter) Close() error {
+	if err := cw.flushChunk(); err != nil {
+		return err
+	}
+	cw.m.Filename = cw.filename
+	data, err := json.Marshal(cw.m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cw.mPath, data, 0600)
+}
+
+func (b *ChunkedEncryptedBackend) Open(path, root string) (io.ReadCloser, int64, error) {
+	mPath, err := b.manifestPath(path, root)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := os.ReadFile(mPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, 0, err
+	}
+	aead, err := chacha20poly1305.NewX(b.masterKey[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		for _, rec := range m.Chunks {
+			ciphertext, err := os.ReadFile(filepath.Join(b.chunksDir, rec.Hash))
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			nonce, err := hex.DecodeString(rec.Nonce)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := pw.Write(plaintext); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return pr, m.Size, nil
+}
+
+func (b *ChunkedEncryptedBackend) Remove(path, root string) error {
+	mPath, err := b.manifestPath(path, root)
+	if err != nil {
+		return err
+	}
+	// Chunks are content-addressed and may be shared with other
+	// manifests, so only the manifest itself is removed; orphaned chunks
+	// are left for a future garbage-collection pass.
+	return os.Remove(mPath)
+}
+
+func (b *ChunkedEncryptedBackend) List(path, root string) ([]FileEntry, error) {
+	rel, err := relUnderRoot(path, root)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(b.manifestsDir, rootNamespace(root), rel)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out := make([]FileEntry, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if e.IsDir() {
+			out = append(out, FileEntry{Name: e.Name(), IsDir: true, ModTime: info.ModTime()})
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var m manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			continue
+		}
+		out = append(out, FileEntry{
+			Name:     m.Filename,
+			Size:     m.Size,
+			Mode:     info.Mode(),
+			ModTime:  info.ModTime(),
+			MimeType: m.MimeType,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// newTestBackend builds a ChunkedEncryptedBackend backed by a temp
+// directory, distinct from the session root(s) passed to its methods in
+// the tests below — mirroring a -k server whose -users homes aren't
+// nested under its storage directory.
+func newTestBackend(t *testing.T) *ChunkedEncryptedBackend {
+    t.Helper()
+    storageDir := t.TempDir()
+
+    keyPath := filepath.Join(storageDir, "master.key")
+    if err := os.WriteFile(keyPath, make([]byte, 32), 0600); err != nil {
+        t.Fatal(err)
+    }
+    b, err := NewChunkedEncryptedBackend(storageDir, keyPath)
+    if err != nil {
+        t.Fatalf("NewChunkedEncryptedBackend: %v", err)
+    }
+    return b
+}
+
+func TestManifestPathRejectsEscapingRoot(t *testing.T) {
+    b := newTestBackend(t)
+    root := t.TempDir()
+
+    if _, err := b.manifestPath(filepath.Join(filepath.Dir(root), "outside", "file.txt"), root); err == nil {
+        t.Fatal("manifestPath accepted a path outside root")
+    }
+    if _, err := b.manifestPath(filepath.Join(root, "docs", "file.txt"), root); err != nil {
+        t.Fatalf("manifestPath rejected a path inside root: %v", err)
+    }
+}
+
+func TestChunkedBackendRoundTripsSharedChunk(t *testing.T) {
+    b := newTestBackend(t)
+    root := t.TempDir()
+
+    write := func(name string, content []byte) {
+        w, err := b.Create(filepath.Join(root, name), root)
+        if err != nil {
+            t.Fatalf("Create %s: %v", name, err)
+        }
+        if _, err := w.Write(content); err != nil {
+            t.Fatalf("Write %s: %v", name, err)
+        }
+        if err := w.Close(); err != nil {
+            t.Fatalf("Close %s: %v", name, err)
+        }
+    }
+
+    content := []byte("identical content, shared chunk across two uploads")
+    write("first.txt", content)
+    write("second.txt", content)
+
+    for _, name := range []string{"first.txt", "second.txt"} {
+        rc, size, err := b.Open(filepath.Join(root, name), root)
+        if err != nil {
+            t.Fatalf("Open %s: %v", name, err)
+        }
+        got, err := io.ReadAll(rc)
+        rc.Close()
+        if err != nil {
+            t.Fatalf("reading %s: %v", name, err)
+        }
+        if int64(len(got)) != size || string(got) != string(content) {
+            t.Fatalf("%s round-tripped to %q, want %q", name, got, content)
+        }
+    }
+}
+
+func TestChunkedBackendMkdirVisibleToList(t *testing.T) {
+    b := newTestBackend(t)
+    root := t.TempDir()
+
+    dirPath := filepath.Join(root, "newdir")
+    if err := b.Mkdir(dirPath, root); err != nil {
+        t.Fatalf("Mkdir: %v", err)
+    }
+
+    if _, err := os.Stat(dirPath); err != nil {
+        t.Errorf("Mkdir did not create a real directory: %v", err)
+    }
+
+    entries, err := b.List(root, root)
+    if err != nil {
+        t.Fatalf("List: %v", err)
+    }
+    var found bool
+    for _, e := range entries {
+        if e.Name == "newdir" && e.IsDir {
+            found = true
+        }
+    }
+    if !found {
+        t.Error("freshly mkdir'd empty directory is not visible in List")
+    }
+}
+
+// TestChunkedBackendSupportsRootOutsideStorageDir reproduces a -k server
+// run together with -users: each user's home is an arbitrary path that
+// need not nest under the backend's own storage directory. Every
+// StorageBackend call must still succeed, namespaced under that root
+// rather than rejected as escaping it.
+func TestChunkedBackendSupportsRootOutsideStorageDir(t *testing.T) {
+    b := newTestBackend(t)
+    userHome := t.TempDir()
+
+    content := []byte("bob's file, stored under a home that isn't under the backend's storage dir")
+    w, err := b.Create(filepath.Join(userHome, "file.txt"), userHome)
+    if err != nil {
+        t.Fatalf("Create: %v", err)
+    }
+    if _, err := w.Write(content); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if err := w.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+
+    rc, size, err := b.Open(filepath.Join(userHome, "file.txt"), userHome)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    got, err := io.ReadAll(rc)
+    rc.Close()
+    if err != nil {
+        t.Fatalf("reading file: %v", err)
+    }
+    if int64(len(got)) != size || string(got) != string(content) {
+        t.Fatalf("round-tripped to %q, want %q", got, content)
+    }
+
+    entries, err := b.List(userHome, userHome)
+    if err != nil {
+        t.Fatalf("List: %v", err)
+    }
+    var found bool
+    for _, e := range entries {
+        if e.Name == "file.txt" {
+            found = true
+        }
+    }
+    if !found {
+        t.Error("uploaded file is not visible in List of its own home")
+    }
+}
+
+// TestChunkedBackendNamespacesDistinctRoots checks that two different
+// session roots with the same relative file layout (e.g. two -users
+// homes) don't collide in the shared manifestsDir.
+func TestChunkedBackendNamespacesDistinctRoots(t *testing.T) {
+    b := newTestBackend(t)
+    aliceHome, bobHome := t.TempDir(), t.TempDir()
+
+    write := func(root string, content []byte) {
+        w, err := b.Create(filepath.Join(root, "notes.txt"), root)
+        if err != nil {
+            t.Fatalf("Create: %v", err)
+        }
+        if _, err := w.Write(content); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+        if err := w.Close(); err != nil {
+            t.Fatalf("Close: %v", err)
+        }
+    }
+
+    write(aliceHome, []byte("alice's notes"))
+    write(bobHome, []byte("bob's notes"))
+
+    rc, _, err := b.Open(filepath.Join(aliceHome, "notes.txt"), aliceHome)
+    if err != nil {
+        t.Fatalf("Open alice's notes.txt: %v", err)
+    }
+    got, err := io.ReadAll(rc)
+    rc.Close()
+    if err != nil {
+        t.Fatalf("reading alice's notes.txt: %v", err)
+    }
+    if string(got) != "alice's notes" {
+        t.Fatalf("alice's notes.txt = %q, want %q (got bob's content instead?)", got, "alice's notes")
+    }
+}
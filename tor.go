@@ -0,0 +1,143 @@
+package main
+
+import (
+    "encoding/hex"
+    "fmt"
+    "net"
+    "net/textproto"
+    "os"
+    "strings"
+)
+
+const defaultTorControlAddr = "127.0.0.1:9051"
+
+// torController is a minimal client for the Tor control protocol, just
+// enough to authenticate and manage an ephemeral onion service.
+type torController struct {
+    conn *textproto.Conn
+}
+
+func dialTorControl(addr string) (*torController, error) {
+    if addr == "" {
+        addr = defaultTorControlAddr
+    }
+    rawConn, err := net.Dial("tcp", addr)
+    if err != nil {
+        return nil, fmt.Errorf("connecting to Tor control port: %w", err)
+    }
+    return &torController{conn: textproto.NewConn(rawConn)}, nil
+}
+
+// authenticate performs AUTHENTICATE against the control port. auth may be
+// empty (no authentication configured), "cookie:<path>" to read a Tor
+// CookieAuthentication file, or a literal control port password.
+func (t *torController) authenticate(auth string) error {
+    var cmd string
+    switch {
+    case auth == "":
+        cmd = "AUTHENTICATE"
+    case strings.HasPrefix(auth, "cookie:"):
+        data, err := os.ReadFile(strings.TrimPrefix(auth, "cookie:"))
+        if err != nil {
+            return fmt.Errorf("reading auth cookie: %w", err)
+        }
+        cmd = "AUTHENTICATE " + hex.EncodeToString(data)
+    default:
+        cmd = fmt.Sprintf("AUTHENTICATE %q", auth)
+    }
+
+    id, err := t.conn.Cmd(cmd)
+    if err != nil {
+        return err
+    }
+    t.conn.StartResponse(id)
+    defer t.conn.EndResponse(id)
+    line, err := t.conn.ReadLine()
+    if err != nil {
+        return err
+    }
+    if !strings.HasPrefix(line, "250") {
+        return fmt.Errorf("AUTHENTICATE failed: %s", line)
+    }
+    return nil
+}
+
+// addOnion issues ADD_ONION, requesting a v3 onion service on virtual port
+// 80 forwarding to 127.0.0.1:localPort. keyBlob is "NEW:ED25519-V3" to
+// create a fresh service, or "ED25519-V3:<base64 key>" to restore one from
+// a previously persisted key. When clientAuthPubKey is non-empty the
+// service requires client authorization with the matching private key.
+func (t *torController) addOnion(keyBlob, localPort, clientAuthPubKey string) (onionAddr, privKey string, err error) {
+    cmd := fmt.Sprintf("ADD_ONION %s Port=80,127.0.0.1:%s", keyBlob, localPort)
+    if clientAuthPubKey != "" {
+        cmd += " Flags=V3Auth ClientAuthV3=" + clientAuthPubKey
+    }
+
+    id, err := t.conn.Cmd(cmd)
+    if err != nil {
+        return "", "", err
+    }
+    t.conn.StartResponse(id)
+    defer t.conn.EndResponse(id)
+
+    for {
+        line, err := t.conn.ReadLine()
+        if err != nil {
+            return "", "", err
+        }
+        switch {
+        case strings.HasPrefix(line, "250-ServiceID="):
+            onionAddr = strings.TrimPrefix(line, "250-ServiceID=") + ".onion"
+        case strings.HasPrefix(line, "250-PrivateKey="):
+            privKey = strings.TrimPrefix(line, "250-PrivateKey=")
+        case strings.HasPrefix(line, "250 OK"):
+            return onionAddr, privKey, nil
+        case strings.HasPrefix(line, "5"):
+            return "", "", fmt.Errorf("ADD_ONION failed: %s", line)
+        }
+    }
+}
+
+func (t *torController) close() error {
+    return t.conn.Close()
+}
+
+// setupOnionService connects to the Tor control port and provisions an
+// ephemeral (or restored, if keyPath already holds a key) v3 onion service
+// that forwards to the local obs instance on port. It returns the
+// resulting .onion address.
+func setupOnionService(port, controlAddr, auth, keyPath, clientAuthPubKey string) (string, error) {
+    ctl, err := dialTorControl(controlAddr)
+    if err != nil {
+        return "", err
+    }
+    defer ctl.close()
+
+    if err := ctl.authenticate(auth); err != nil {
+        return "", err
+    }
+
+    keyBlob := "NEW:ED25519-V3"
+    if keyPath != "" {
+        if existing, err := os.ReadFile(keyPath); err == nil && len(existing) > 0 {
+            keyBlob = "ED25519-V3:" + strings.TrimSpace(string(existing))
+        }
+    }
+
+    onionAddr, privKey, err := ctl.addOnion(keyBlob, port, clientAuthPubKey)
+    if err != nil {
+        return "", err
+    }
+
+    if keyPath != "" && privKey != "" {
+        // privKey comes back as "ED25519-V3:<blob>"; persist only the blob
+        // so it can be re-prepended with "ED25519-V3:" on restart without
+        // doubling the key-type prefix.
+        blob := strings.TrimPrefix(privKey, "ED25519-V3:")
+        if err := os.WriteFile(keyPath, []byte(blob), 0600); err != nil {
+            fmt.Println("Warning: could not persist onion service key:", err)
+        }
+    }
+
+    return onionAddr, nil
+}
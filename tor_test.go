@@ -0,0 +1,68 @@
+package main
+
+import (
+    "bufio"
+    "net"
+    "net/textproto"
+    "strings"
+    "testing"
+)
+
+// fakeTorControl accepts one connection on a net.Pipe, replies 250 OK to
+// AUTHENTICATE, and checks the ADD_ONION command line it receives before
+// replying with a canned onion address.
+func fakeTorControl(t *testing.T, client net.Conn) {
+    t.Helper()
+    r := bufio.NewReader(client)
+    w := client
+
+    authLine, err := r.ReadString('\n')
+    if err != nil {
+        t.Errorf("reading AUTHENTICATE: %v", err)
+        return
+    }
+    if !strings.HasPrefix(authLine, "AUTHENTICATE") {
+        t.Errorf("first command = %q, want AUTHENTICATE", authLine)
+    }
+    w.Write([]byte("250 OK\r\n"))
+
+    addOnionLine, err := r.ReadString('\n')
+    if err != nil {
+        t.Errorf("reading ADD_ONION: %v", err)
+        return
+    }
+    if !strings.Contains(addOnionLine, "ClientAuthV3=clientpubkey123") {
+        t.Errorf("ADD_ONION command = %q, want it to carry ClientAuthV3=clientpubkey123", addOnionLine)
+    }
+    w.Write([]byte("250-ServiceID=exampleonionaddr\r\n250-PrivateKey=ED25519-V3:examplekey\r\n250 OK\r\n"))
+}
+
+// TestAddOnionCarriesClientAuth documents the actual mechanism -tor-client-auth
+// relies on: the server passes the client's x25519 public key to Tor via
+// ADD_ONION's ClientAuthV3 flag over the control port, not anything carried
+// on the client's SOCKS5 connection (which is why obc's connection has no
+// matching flag to set).
+func TestAddOnionCarriesClientAuth(t *testing.T) {
+    serverConn, clientConn := net.Pipe()
+    defer serverConn.Close()
+    defer clientConn.Close()
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        fakeTorControl(t, clientConn)
+    }()
+
+    ctl := &torController{conn: textproto.NewConn(serverConn)}
+    if err := ctl.authenticate(""); err != nil {
+        t.Fatalf("authenticate: %v", err)
+    }
+    onionAddr, _, err := ctl.addOnion("NEW:ED25519-V3", "8080", "clientpubkey123")
+    if err != nil {
+        t.Fatalf("addOnion: %v", err)
+    }
+    if onionAddr != "exampleonionaddr.onion" {
+        t.Errorf("onionAddr = %q, want %q", onionAddr, "exampleonionaddr.onion")
+    }
+    <-done
+}